@@ -2,37 +2,95 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math/rand"
 	"net"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/langlandsbrogram/asscam/pkg/audio"
 	"github.com/langlandsbrogram/asscam/pkg/message"
+	"github.com/langlandsbrogram/asscam/pkg/terminal"
 	"github.com/langlandsbrogram/asscam/pkg/video"
 )
 
+// maxWidth is the widest video sent, enough for a 4K screen full of
+// small cells.
+const maxWidth = 4096
+
+// sentChunks is how many of the last chunks sent are kept to answer
+// nacks with.
+const sentChunks = 1024
+
+// playoutTick is how often frames due to be shown are looked for.
+const playoutTick = 5 * time.Millisecond
+
+// keyframeRetry is how long to wait for a keyframe before asking again.
+const keyframeRetry = 500 * time.Millisecond
+
+// maxDatagram is the biggest UDP datagram, so that rosters of long names
+// and nacks of many chunks are read whole whatever the chunk size.
+const maxDatagram = 64 * 1024
+
 // Config holds configuration parsed from CLI arguments
 type Config struct {
 	ServerAddr     string
 	Name           string
+	Room           string
 	Width          int
 	Hide           bool
 	FrameChunkSize int
+	ServerTimeout  time.Duration
+	Source         string
+	Record         string
+	Color          video.ColorMode
+	Charset        video.Charset
+	Keyframe       time.Duration
+	FEC            bool
+	Delay          time.Duration
+	Sync           time.Duration
+	Codec          audio.Codec
+	VAD            bool
+	Chain          audio.ChainConfig
+	AEC            bool
+	Mic            string
+	Speaker        string
 }
 
 // argsParsing parses CLI arguments and returns Config or error
 func argsParsing() (Config, error) {
 	var config Config
+	var color, charset, codec string
 
 	// Define flags
 	flag.StringVar(&config.ServerAddr, "server", "", "Server address (e.g., 198.1.1.8:6969)")
 	flag.StringVar(&config.Name, "name", "", "Your name")
-	flag.IntVar(&config.Width, "width", 0, "Width of the video")
+	flag.StringVar(&config.Room, "room", "lobby", "Room to join (default: lobby)")
+	flag.IntVar(&config.Width, "width", 0, "Width of the video in columns, up to 4096 (default: 255)")
 	flag.IntVar(&config.FrameChunkSize, "chunksize", 256, "Frame chunk size (default: 256)")
+	flag.DurationVar(&config.ServerTimeout, "timeout", 5*time.Second, "Reconnect to a server not heard from for this long (default: 5s)")
+	flag.StringVar(&config.Source, "source", "webcam", "Video source: webcam, webcam:N, pattern, a .asscam recording, an image directory or a video file (default: webcam)")
+	flag.StringVar(&config.Record, "record", "", "Record the video you send to this .asscam file")
+	flag.StringVar(&color, "color", "auto", "Colors to show: auto, mono, 256 or truecolor (default: auto)")
+	flag.StringVar(&charset, "charset", "ascii", "Characters to draw your video with: ascii, halfblock or braille (default: ascii)")
+	flag.DurationVar(&config.Keyframe, "keyframe", 2*time.Second, "Send a whole frame at least this often, only changes in between (default: 2s)")
+	flag.BoolVar(&config.FEC, "fec", true, "Send parity chunks to rebuild lost ones, as many as the loss peers report needs (default: true)")
+	flag.DurationVar(&config.Delay, "delay", 100*time.Millisecond, "Hold received video this long to show it smoothly and in order (default: 100ms)")
+	flag.DurationVar(&config.Sync, "sync", 40*time.Millisecond, "Let received video drift this far from its audio before moving it back in step (default: 40ms)")
+	flag.StringVar(&codec, "codec", "adpcm", "Audio codec to send with when everyone can decode it: pcm, mulaw, alaw or adpcm (default: adpcm)")
+	flag.BoolVar(&config.VAD, "vad", true, "Send only comfort noise while you are not speaking (default: true)")
+	flag.Float64Var(&config.Chain.HighPass, "highpass", 80, "Cut your audio below this many Hz, 0 to keep it all (default: 80)")
+	flag.Float64Var(&config.Chain.Gate, "gate", -50, "Silence your audio while quieter than this many dBFS, 0 to never (default: -50)")
+	flag.Float64Var(&config.Chain.Target, "agc", -20, "Turn your audio up or down to this many dBFS, 0 to leave it (default: -20)")
+	flag.BoolVar(&config.AEC, "aec", true, "Cancel the echo of your speakers from your microphone (default: true)")
+	flag.StringVar(&config.Mic, "mic", "mic", "Audio source: mic, tone, tone:HZ or a .wav file (default: mic)")
+	flag.StringVar(&config.Speaker, "speaker", "speaker", "Audio sink: speaker, null or a .wav file to record what you hear to (default: speaker)")
 	flag.BoolVar(&config.Hide, "hide", false, "Flag to indicate whether to show video or not")
 
 	// Parse command-line arguments
@@ -49,8 +107,34 @@ func argsParsing() (Config, error) {
 		return config, fmt.Errorf("name is required")
 	}
 
-	if config.Width == 0 || config.Width >= 255 {
+	if config.Room == "" || len(config.Room) > 255 {
+		flag.PrintDefaults()
+		return config, fmt.Errorf("room must be 1-255 bytes")
+	}
+
+	mode, err := video.ParseColorMode(color)
+	if err != nil {
+		flag.PrintDefaults()
+		return config, err
+	}
+	config.Color = mode
+
+	config.Charset, err = video.ParseCharset(charset)
+	if err != nil {
+		flag.PrintDefaults()
+		return config, err
+	}
+
+	config.Codec, err = audio.ParseCodec(codec)
+	if err != nil {
+		flag.PrintDefaults()
+		return config, err
+	}
+
+	if config.Width == 0 {
 		config.Width = 255
+	} else if config.Width > maxWidth {
+		config.Width = maxWidth
 	}
 
 	if config.FrameChunkSize > 1024 {
@@ -82,11 +166,11 @@ func main() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	defer removeMe(conn)
-
-	msg := message.MakeInfo(args.Name)
-	_, err = conn.Write(msg)
+	session := rand.Uint32()
+	defer removeMe(conn, session)
 
+	join := message.Join{Room: args.Room, Name: args.Name, Color: uint8(args.Color), Codecs: audio.Supported}
+	join.Token, err = handshake(conn, session, join, args.ServerTimeout)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -97,79 +181,279 @@ func main() {
 
 	go handleInterupt(cancel)
 
-	frames, err := video.Start(ctx, args.Width)
+	source, err := video.OpenSource(args.Source, args.Width, args.Charset)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	frames := video.Start(ctx, source)
+
+	var recorder *video.Recorder
+	if args.Record != "" {
+		recorder, err = video.NewRecorder(args.Record)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer recorder.Close()
+	}
 
-	aud, err := audio.NewAudio()
+	mic, err := audio.OpenSource(args.Mic)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	aud := audio.NewAudio(mic)
 	defer aud.Close()
 
-	go aud.Start()
-
-	player, err := audio.NewPlayer()
+	speaker, err := audio.OpenSink(args.Speaker)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	player := audio.NewPlayer(speaker)
 	defer player.Close()
-	player.Start()
-
-	datas := dataStream(ctx, conn, args.FrameChunkSize)
 
-	chunkCatcher := video.NewFrameCatcher()
+	chain := audio.NewChain(args.Chain)
+	if args.AEC {
+		// the echo goes before anything that changes the gain
+		echo := audio.NewEchoCanceller()
+		player.SetEchoCanceller(echo)
+		chain = append(audio.Chain{echo}, chain...)
+	}
+	aud.SetChain(chain)
+	aud.SuppressSilence(args.VAD)
+	audioErr := make(chan error, 1)
+	go func() {
+		audioErr <- aud.Start()
+	}()
+	player.Start()
 
+	datas := dataStream(ctx, conn)
+
+	// frame ids are only unique per sender, so each peer gets its own catcher
+	chunkCatchers := make(map[uint32]*video.FrameChunkCatcher)
+	keyframeRequested := make(map[uint32]time.Time)
+	// names of the peers in the room by session
+	peers := make(map[uint32]string)
+	// frames wait in a playout buffer per peer until they are due
+	playouts := make(map[uint32]*video.Playout)
+	playout := time.NewTicker(playoutTick)
+	defer playout.Stop()
+	gallery := video.NewGallery(terminal.Size())
+	gallery.SetColorMode(args.Color)
+
+	// frames are sent with as many colors as the best terminal in the room
+	// can show, everyone else reduces them when drawing
+	sendMode := video.Mono
+	// and audio with the codec asked for when everyone can decode it,
+	// shared with the audio sender
+	var sendCodec atomic.Uint32
+	sendCodec.Store(uint32(audio.PCM))
+
+	encoder := video.NewFrameEncoder(args.Keyframe)
+	// the loss each peer last reported for our frames, in thousandths
+	lossReports := make(map[uint32]uint16)
+	parityGroup := 0
+	sent := video.NewChunkRing(sentChunks)
 	var frameId uint32
-	var oldFrame video.Frame
-	var lastFrameTime time.Time
 
-	go func() {
+	// the server pings every couple of seconds, so silence means it is gone
+	lastHeard := time.Now()
+	liveness := time.NewTicker(time.Second)
+	defer liveness.Stop()
+	var reconnecting atomic.Bool
 
+	// audio goes out on its own, never waiting on the video below
+	go func() {
 		for audioSeg := range aud.Output {
-			msg := message.MakeAudio(audioSeg)
+			if reconnecting.Load() {
+				continue
+			}
+			if audioSeg.Codec != audio.ComfortNoise {
+				audioSeg.Codec = audio.Codec(sendCodec.Load())
+			}
+			msg := message.MakeAudio(session, audioSeg.Encode())
 			conn.Write(msg)
 		}
 	}()
 
 	for {
 		select {
+		case err := <-audioErr:
+			if errors.Is(err, io.EOF) {
+				gallery.Status("your audio source ended")
+			} else {
+				gallery.Status(fmt.Sprintf("your audio stopped: %v", err))
+			}
 		case frame := <-frames:
-			encoded := frame.RunLengthEncode()
-			chunks := video.ChunkFrameData(encoded, args.FrameChunkSize, frameId, lastFrameTime)
+			if recorder != nil {
+				recorder.Record(frame.ColorFrame)
+			}
+			if reconnecting.Load() {
+				continue
+			}
+			encoded := encoder.Encode(frame.ColorFrame, frameId, sendMode)
+			// stamped when captured, as audio packets are, for peers to
+			// play the two in sync
+			chunks := video.ChunkFrameData(encoded, args.FrameChunkSize, frameId, frame.At)
+			chunks = video.AddParity(chunks, parityGroup)
 			for _, c := range chunks {
+				sent.Add(c)
 				data := c.Encode()
-				msg := message.MakeFrame(data)
+				msg := message.MakeFrame(session, data)
 				conn.Write(msg)
 			}
 
 			frameId++
 
 		case data := <-datas:
-			switch data, msg := message.Parse(data); msg {
+			h, data, err := message.Parse(data)
+			if err != nil {
+				continue
+			}
+			lastHeard = time.Now()
+			switch h.Type {
 			case message.Info:
+				token, err := message.ParseWelcome(data)
+				if err != nil {
+					continue
+				}
+				// rejoining with the token restores our session and room
+				join.Token = token
+				if reconnecting.Load() {
+					reconnecting.Store(false)
+					gallery.Status("")
+					encoder.RequestKeyframe()
+				}
 			case message.Audio:
-				d := make([]byte, len(data))
-				copy(d, data)
-				player.Input <- d
+				var packet audio.Packet
+				if err := packet.Decode(data); err != nil {
+					continue
+				}
+				player.Push(h.Session, packet)
 			case message.Frame:
-				if len(data) < 5 {
+				chunkCatcher, ok := chunkCatchers[h.Session]
+				if !ok {
+					chunkCatcher = video.NewFrameCatcher()
+					chunkCatchers[h.Session] = chunkCatcher
+				}
+				frame, ts := chunkCatcher.CatchColor(data)
+				if frame.Frame != nil {
+					p, ok := playouts[h.Session]
+					if !ok {
+						p = video.NewPlayout(args.Delay)
+						playouts[h.Session] = p
+					}
+					p.Push(frame, ts, time.Now())
+				}
+				sendNacks(conn, session, h.Session, chunkCatcher)
+				if chunkCatcher.NeedsKeyframe() && time.Since(keyframeRequested[h.Session]) > keyframeRetry {
+					conn.Write(message.MakeKeyframe(session, h.Session))
+					keyframeRequested[h.Session] = time.Now()
+				}
+			case message.Nack:
+				var missing message.Missing
+				if err := missing.Decode(data); err != nil || missing.Target != session {
 					continue
 				}
-
-				frame, _ := chunkCatcher.Catch(data)
-				if frame != nil {
-					frame.Display(oldFrame)
-					oldFrame = frame
-					_ = oldFrame
+				for _, seq := range missing.Sequences {
+					if c, ok := sent.Get(missing.FrameId, seq); ok {
+						conn.Write(message.MakeFrame(session, c.Encode()))
+					}
+				}
+			case message.Loss:
+				target, permille, err := message.ParseLoss(data)
+				if err != nil || target != session || !args.FEC {
+					continue
+				}
+				lossReports[h.Session] = permille
+				parityGroup = video.ParityGroup(worstLoss(lossReports))
+			case message.Keyframe:
+				if target, err := message.ParseKeyframe(data); err == nil && target == session {
+					encoder.RequestKeyframe()
+				}
+			case message.Roster:
+				var roster message.Peers
+				if err := roster.Decode(data); err != nil {
+					continue
+				}
+				peers = make(map[uint32]string)
+				var codecs []uint8
+				sendMode = video.Mono
+				for _, p := range roster {
+					if p.Session != session {
+						peers[p.Session] = p.Name
+						codecs = append(codecs, p.Codecs)
+						sendMode = max(sendMode, video.ColorMode(p.Color))
+					}
+				}
+				sendMode = min(sendMode, video.TrueColor)
+				sendCodec.Store(uint32(audio.Negotiate(args.Codec, codecs)))
+				for id := range chunkCatchers {
+					if _, ok := peers[id]; !ok {
+						delete(chunkCatchers, id)
+						delete(keyframeRequested, id)
+						delete(playouts, id)
+						player.Remove(id)
+					}
 				}
+				for id := range lossReports {
+					if _, ok := peers[id]; !ok {
+						delete(lossReports, id)
+					}
+				}
+				parityGroup = video.ParityGroup(worstLoss(lossReports))
+				gallery.SetPeers(peers)
+				// whoever just joined has nothing to apply our deltas to
+				encoder.RequestKeyframe()
+			case message.Ping:
+				conn.Write(message.MakePong(session, data))
+			case message.Left:
+				delete(peers, h.Session)
+				delete(chunkCatchers, h.Session)
+				delete(keyframeRequested, h.Session)
+				delete(playouts, h.Session)
+				player.Remove(h.Session)
+				delete(lossReports, h.Session)
 			case message.Error:
+				reason := string(data)
+				if reason == "empty" {
+					gallery.Placeholder(fmt.Sprintf("waiting for someone to join %s…", args.Room))
+				} else if reconnecting.Load() {
+					terminal.ClearScreen()
+					fmt.Printf("could not rejoin room %s: %s\n", args.Room, reason)
+					return
+				}
 			case message.Unknown:
 			}
+		case now := <-playout.C:
+			for id := range peers {
+				gallery.SetSpeaking(id, player.Speaking(id))
+			}
+			for id, p := range playouts {
+				if ts, at, ok := player.Playing(id); ok {
+					p.Sync(ts, at, args.Sync)
+				}
+				if frame, ok := p.Pop(now); ok {
+					gallery.Show(id, frame)
+				}
+			}
+		case <-liveness.C:
+			// tell every peer how much of its video got lost on the way
+			for id, chunkCatcher := range chunkCatchers {
+				if loss, ok := chunkCatcher.Loss(); ok {
+					conn.Write(message.MakeLoss(session, id, uint16(loss*1000)))
+				}
+				sendNacks(conn, session, id, chunkCatcher)
+			}
+			if time.Since(lastHeard) > args.ServerTimeout {
+				if !reconnecting.Load() {
+					reconnecting.Store(true)
+					gallery.Status(fmt.Sprintf("reconnecting to %s…", args.ServerAddr))
+				}
+				sendJoin(conn, session, join)
+			}
 		case <-ctx.Done():
 			return
 		}
@@ -185,10 +469,10 @@ func handleInterupt(cancel context.CancelFunc) {
 
 }
 
-func dataStream(ctx context.Context, conn *net.UDPConn, chunkSize int) chan []byte {
+func dataStream(ctx context.Context, conn *net.UDPConn) chan []byte {
 	c := make(chan []byte)
 	go func() {
-		buffer := make([]byte, chunkSize+128)
+		buffer := make([]byte, maxDatagram)
 		for {
 			select {
 			case <-ctx.Done():
@@ -206,14 +490,86 @@ func dataStream(ctx context.Context, conn *net.UDPConn, chunkSize int) chan []by
 	return c
 }
 
-func sendName(conn *net.UDPConn, name string) error {
-	msg := message.MakeInfo(name)
+// handshake joins the room and waits for the server's welcome, resending
+// the join every second until timeout. It returns the resume token.
+func handshake(conn *net.UDPConn, session uint32, join message.Join, timeout time.Duration) (uint64, error) {
+	defer conn.SetReadDeadline(time.Time{})
+
+	buffer := make([]byte, maxDatagram)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if err := sendJoin(conn, session, join); err != nil {
+			return 0, err
+		}
+
+		readDeadline := time.Now().Add(time.Second)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+		conn.SetReadDeadline(readDeadline)
+
+		for {
+			n, err := conn.Read(buffer)
+			if err != nil {
+				// a refused connection fails straight away, so wait out the
+				// second before trying again
+				time.Sleep(time.Until(readDeadline))
+				break
+			}
+
+			h, data, err := message.Parse(buffer[:n])
+			var versionErr *message.VersionError
+			if errors.As(err, &versionErr) {
+				return 0, fmt.Errorf("server speaks a different protocol: %w", err)
+			} else if err != nil {
+				continue
+			}
+
+			switch h.Type {
+			case message.Info:
+				if token, err := message.ParseWelcome(data); err == nil {
+					return token, nil
+				}
+			case message.Error:
+				switch reason := string(data); reason {
+				case "empty":
+				case "full":
+					return 0, fmt.Errorf("room %s is full", join.Room)
+				default:
+					return 0, fmt.Errorf("could not join room %s: %s", join.Room, reason)
+				}
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no answer from server %s", conn.RemoteAddr())
+}
+
+// sendNacks asks peer for the chunks of its frames that are overdue.
+func sendNacks(conn *net.UDPConn, session, peer uint32, chunkCatcher *video.FrameChunkCatcher) {
+	for _, m := range chunkCatcher.Missing(time.Now()) {
+		msg := message.MakeNack(session, message.Missing{Target: peer, FrameId: m.FrameId, Sequences: m.Sequences})
+		conn.Write(msg)
+	}
+}
+
+// worstLoss is the highest of the loss reports as a fraction.
+func worstLoss(reports map[uint32]uint16) float64 {
+	var worst uint16
+	for _, permille := range reports {
+		worst = max(worst, permille)
+	}
+	return float64(worst) / 1000
+}
+
+func sendJoin(conn *net.UDPConn, session uint32, join message.Join) error {
+	msg := message.MakeJoin(session, join)
 	_, err := conn.Write(msg)
 	return err
 }
 
-func removeMe(conn *net.UDPConn) {
-	msg := []byte{99}
+func removeMe(conn *net.UDPConn, session uint32) {
+	msg := message.MakeError(session, "bye")
 	conn.Write(msg)
 }
 
@@ -1,20 +1,70 @@
 package main
 
-import "net"
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"time"
+)
 
 type Bro struct {
-	addr net.Addr
-	name string
+	addr    net.Addr
+	name    string
+	session uint32
+	// token lets the bro resume its session after losing the connection
+	token uint64
+	// color is the color mode of the bro's terminal
+	color uint8
+	// codecs has a bit set for every audio codec the bro can decode
+	codecs uint8
+	// queue holds messages waiting to be written to this bro, so a slow
+	// receiver only ever delays itself and never the read loop.
+	queue    chan []byte
+	dropped  int
+	lastSeen time.Time
 }
 
-type Bros map[string]Bro
+func newBro(addr net.Addr, name string, session uint32, token uint64, queueSize int) *Bro {
+	return &Bro{
+		addr:     addr,
+		name:     name,
+		session:  session,
+		token:    token,
+		queue:    make(chan []byte, queueSize),
+		lastSeen: time.Now(),
+	}
+}
+
+// send queues msg without blocking, dropping it if the queue is full.
+func (b *Bro) send(msg []byte) bool {
+	select {
+	case b.queue <- msg:
+		return true
+	default:
+		b.dropped++
+		return false
+	}
+}
+
+// serve drains the queue onto conn until the bro is closed.
+func (b *Bro) serve(conn net.PacketConn) {
+	for msg := range b.queue {
+		conn.WriteTo(msg, b.addr)
+	}
+}
+
+func (b *Bro) close() {
+	close(b.queue)
+}
+
+type Bros map[string]*Bro
 
 func NewBros() Bros {
 	return make(Bros)
 }
 
-func (bros Bros) isRoomFull(addr net.Addr) bool {
-	if len(bros) < 2 {
+func (bros Bros) isRoomFull(addr net.Addr, capacity int) bool {
+	if len(bros) < capacity {
 		return false
 	}
 	for k := range bros {
@@ -25,19 +75,54 @@ func (bros Bros) isRoomFull(addr net.Addr) bool {
 	return true
 }
 
-func (bros Bros) otherBro(addr net.Addr) (net.Addr, bool) {
+func (bros Bros) otherBros(addr net.Addr) []*Bro {
+	var others []*Bro
 	for k, v := range bros {
 		if k != addr.String() {
-			return v.addr, true
+			others = append(others, v)
+		}
+	}
+	return others
+}
+
+func (bros Bros) bySession(session uint32) (*Bro, bool) {
+	for _, v := range bros {
+		if v.session == session {
+			return v, true
 		}
 	}
 	return nil, false
 }
 
+// sessionTaken reports whether a bro other than the one at addr already
+// uses session, which would make forwarded messages ambiguous.
+func (bros Bros) sessionTaken(addr net.Addr, session uint32) bool {
+	for k, v := range bros {
+		if k != addr.String() && v.session == session {
+			return true
+		}
+	}
+	return false
+}
+
 func (bros Bros) remove(addr net.Addr) {
-	delete(bros, addr.String())
+	if bro, ok := bros[addr.String()]; ok {
+		bro.close()
+		delete(bros, addr.String())
+	}
+}
+
+func (bros Bros) add(bro *Bro) {
+	bros[bro.addr.String()] = bro
 }
 
-func (bros Bros) add(addr net.Addr, name string) {
-	bros[addr.String()] = Bro{addr: addr, name: name}
+// newToken returns an unguessable, non-zero resume token.
+func newToken() uint64 {
+	var buf [8]byte
+	for {
+		rand.Read(buf[:])
+		if token := binary.LittleEndian.Uint64(buf[:]); token != 0 {
+			return token
+		}
+	}
 }
@@ -6,13 +6,26 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/langlandsbrogram/asscam/pkg/message"
 )
 
+// maxDatagram is the biggest UDP datagram, so that what a bro sends with
+// a large chunk size is read whole rather than cut short.
+const maxDatagram = 64 * 1024
+
 type Config struct {
-	Port int
-	Ip   string
+	Port           int
+	Ip             string
+	RoomCapacity   int
+	MaxRooms       int
+	AutoCreate     bool
+	PermanentRooms []string
+	QueueSize      int
+	PingInterval   time.Duration
+	Timeout        time.Duration
 }
 
 // argsParsing parses CLI arguments and returns Config or error
@@ -22,6 +35,13 @@ func argsParsing() (Config, error) {
 	// Define flags
 	flag.StringVar(&config.Ip, "ip", "127.0.0.1", "Ip to listen on (default: 127.0.0.1)")
 	flag.IntVar(&config.Port, "port", 6969, "Port to listen on (default: 6969)")
+	flag.IntVar(&config.RoomCapacity, "capacity", 8, "Maximum bros per room (default: 8)")
+	flag.IntVar(&config.QueueSize, "queue", 256, "Messages buffered per bro before dropping (default: 256)")
+	flag.IntVar(&config.MaxRooms, "maxrooms", 0, "Maximum number of rooms, 0 for unlimited (default: 0)")
+	flag.BoolVar(&config.AutoCreate, "autocreate", true, "Create rooms on first join and destroy them on last leave (default: true)")
+	flag.DurationVar(&config.PingInterval, "ping", 2*time.Second, "How often bros are pinged (default: 2s)")
+	flag.DurationVar(&config.Timeout, "timeout", 10*time.Second, "Evict bros not heard from for this long (default: 10s)")
+	rooms := flag.String("rooms", "", "Comma separated rooms that always exist (e.g., lobby,standup)")
 
 	// Parse command-line arguments
 	flag.Parse()
@@ -33,6 +53,32 @@ func argsParsing() (Config, error) {
 		return config, errors.New("Error: 1000 < PORT <= 65535")
 	}
 
+	if config.QueueSize < 1 {
+		flag.PrintDefaults()
+		return config, errors.New("Error: QUEUE >= 1")
+	}
+
+	if config.PingInterval <= 0 || config.Timeout <= config.PingInterval {
+		flag.PrintDefaults()
+		return config, errors.New("Error: 0 < PING < TIMEOUT")
+	}
+
+	if config.RoomCapacity < 2 {
+		flag.PrintDefaults()
+		return config, errors.New("Error: CAPACITY >= 2")
+	}
+
+	for _, name := range strings.Split(*rooms, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			config.PermanentRooms = append(config.PermanentRooms, name)
+		}
+	}
+
+	if !config.AutoCreate && len(config.PermanentRooms) == 0 {
+		flag.PrintDefaults()
+		return config, errors.New("Error: -rooms is required when -autocreate=false")
+	}
+
 	return config, nil
 }
 
@@ -58,61 +104,118 @@ func main() {
 
 	fmt.Printf("Listening on %s ...\n", conn.LocalAddr())
 
-	handleConns(conn)
-}
+	rooms := NewRooms(conn, RoomsConfig{
+		Capacity:   args.RoomCapacity,
+		MaxRooms:   args.MaxRooms,
+		AutoCreate: args.AutoCreate,
+		Permanent:  args.PermanentRooms,
+		QueueSize:  args.QueueSize,
+	})
 
-func handleConns(conn *net.UDPConn) {
+	handleConns(conn, rooms, args.PingInterval, args.Timeout)
+}
 
-	bros := NewBros()
+func handleConns(conn *net.UDPConn, rooms *Rooms, pingInterval, timeout time.Duration) {
 
-	buf := make([]byte, 2048)
+	buf := make([]byte, maxDatagram)
 
 	stats := NewStats(1)
 
 	go stats.Check()
 
+	// the read loop owns rooms, so heartbeats run in it too: the read
+	// deadline wakes it up when no traffic arrives
+	lastPing := time.Now()
+
 	for {
 
+		if now := time.Now(); now.Sub(lastPing) >= pingInterval {
+			rooms.evict(now, timeout)
+			rooms.ping(now)
+			lastPing = now
+		}
+		conn.SetReadDeadline(lastPing.Add(pingInterval))
+
 		n, addr, err := conn.ReadFrom(buf)
-		if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			continue
+		} else if err != nil {
 			fmt.Println("Error: ", err)
 			continue
 		}
 
-		if bros.isRoomFull(addr) {
-			msg := message.MakeError("full")
+		h, data, err := message.Parse(buf[:n])
+		var versionErr *message.VersionError
+		if errors.As(err, &versionErr) {
+			msg := message.MakeError(0, "version mismatch")
 			conn.WriteTo(msg, addr)
 			continue
+		} else if err != nil {
+			fmt.Printf("dropping message from %s: %s\n", addr, err)
+			continue
 		}
 
-		switch data, msg := message.Parse(buf[:n]); msg {
+		rooms.touch(addr, time.Now())
+
+		switch h.Type {
 		case message.Info:
-			name := string(data)
-			bros.add(addr, name)
-			msg := message.MakeInfo("ok")
+			var join message.Join
+			if err := join.Decode(data); err != nil {
+				fmt.Printf("bad join from %s: %s\n", addr, err)
+				continue
+			}
+			room, err := rooms.join(addr, join, h.Session)
+			if err != nil {
+				msg := message.MakeError(0, err.Error())
+				conn.WriteTo(msg, addr)
+				continue
+			}
+			bro, _ := rooms.broAt(addr)
+			msg := message.MakeWelcome(bro.token)
 			conn.WriteTo(msg, addr)
+			room.announce()
 		case message.Frame:
 			stats.ProcessBytes(n)
-			if otherAddr, ok := bros.otherBro(addr); ok {
-				msg := message.MakeFrame(data)
-				conn.WriteTo(msg, otherAddr)
-			} else {
-				msg := message.MakeError("empty")
+			room, ok := rooms.roomOf(addr)
+			if !ok {
+				continue
+			}
+			// the session in the header tells receivers who sent it
+			msg := message.MakeFrame(h.Session, data)
+			if room.forward(addr, msg) == 0 && len(room.bros) < 2 {
+				msg := message.MakeError(0, "empty")
 				conn.WriteTo(msg, addr)
 			}
 		case message.Audio:
 			stats.ProcessBytes(n)
-			if otherAddr, ok := bros.otherBro(addr); ok {
-				msg := message.MakeAudio(data)
-				conn.WriteTo(msg, otherAddr)
-			} else {
-				msg := message.MakeError("empty")
+			room, ok := rooms.roomOf(addr)
+			if !ok {
+				continue
+			}
+			msg := message.MakeAudio(h.Session, data)
+			if room.forward(addr, msg) == 0 && len(room.bros) < 2 {
+				msg := message.MakeError(0, "empty")
 				conn.WriteTo(msg, addr)
 			}
+		case message.Keyframe, message.Loss, message.Nack:
+			// answered by the sender of the video, so only it gets them
+			room, ok := rooms.roomOf(addr)
+			if !ok {
+				continue
+			}
+			target, err := message.Target(data)
+			if err != nil {
+				continue
+			}
+			room.sendTo(target, message.Make(h.Type, h.Session, data))
+		case message.Pong:
 		case message.Error:
-			bros.remove(addr)
+			if bro, ok := rooms.broAt(addr); ok {
+				rooms.leave(addr).announceLeft(bro)
+			}
 		case message.Unknown:
-			fmt.Printf("received unknown message byte: %d; skipping\n", buf[0])
+			fmt.Printf("received unknown message type: %d; skipping\n", buf[1])
 		}
 
 	}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/langlandsbrogram/asscam/pkg/message"
+)
+
+var (
+	errRoomFull     = errors.New("full")
+	errNoSuchRoom   = errors.New("no such room")
+	errTooManyRooms = errors.New("too many rooms")
+	errSessionTaken = errors.New("session taken")
+)
+
+type Room struct {
+	name      string
+	capacity  int
+	permanent bool
+	bros      Bros
+}
+
+// Rooms is the registry of every room on the server, plus an index from
+// bro address to the room that bro is in.
+type Rooms struct {
+	rooms      map[string]*Room
+	byAddr     map[string]*Room
+	capacity   int
+	maxRooms   int
+	autoCreate bool
+	queueSize  int
+	conn       net.PacketConn
+}
+
+type RoomsConfig struct {
+	Capacity   int
+	MaxRooms   int
+	AutoCreate bool
+	Permanent  []string
+	QueueSize  int
+}
+
+// NewRooms builds the registry. Forwarded messages are written to conn by
+// one goroutine per bro.
+func NewRooms(conn net.PacketConn, config RoomsConfig) *Rooms {
+	rooms := &Rooms{
+		rooms:      make(map[string]*Room),
+		byAddr:     make(map[string]*Room),
+		capacity:   config.Capacity,
+		maxRooms:   config.MaxRooms,
+		autoCreate: config.AutoCreate,
+		queueSize:  config.QueueSize,
+		conn:       conn,
+	}
+	for _, name := range config.Permanent {
+		rooms.rooms[name] = &Room{
+			name:      name,
+			capacity:  config.Capacity,
+			permanent: true,
+			bros:      NewBros(),
+		}
+	}
+	return rooms
+}
+
+// join puts the bro at addr into the named room, creating the room if
+// allowed and moving the bro out of any room it was in before. A bro
+// presenting the resume token of an existing session takes that session
+// over, even from another address.
+func (rs *Rooms) join(addr net.Addr, join message.Join, session uint32) (*Room, error) {
+	roomName, token := join.Room, join.Token
+	room, ok := rs.rooms[roomName]
+	if !ok {
+		if !rs.autoCreate {
+			return nil, errNoSuchRoom
+		}
+		if rs.maxRooms > 0 && len(rs.rooms) >= rs.maxRooms {
+			return nil, errTooManyRooms
+		}
+		room = &Room{
+			name:     roomName,
+			capacity: rs.capacity,
+			bros:     NewBros(),
+		}
+	}
+
+	if old, ok := room.bros.bySession(session); ok && token != 0 && old.token == token {
+		if old.addr.String() != addr.String() {
+			rs.leave(old.addr)
+		}
+	} else {
+		token = newToken()
+	}
+
+	if room.bros.isRoomFull(addr, room.capacity) {
+		return nil, errRoomFull
+	}
+
+	if room.bros.sessionTaken(addr, session) {
+		return nil, errSessionTaken
+	}
+
+	if current, ok := rs.byAddr[addr.String()]; ok && current != room {
+		bro, _ := rs.broAt(addr)
+		rs.leave(addr).announceLeft(bro)
+	}
+
+	rs.rooms[roomName] = room
+	if bro, ok := room.bros[addr.String()]; ok {
+		bro.name = join.Name
+		bro.session = session
+		bro.token = token
+		bro.color = join.Color
+		bro.codecs = join.Codecs
+		bro.lastSeen = time.Now()
+	} else {
+		bro := newBro(addr, join.Name, session, token, rs.queueSize)
+		bro.color = join.Color
+		bro.codecs = join.Codecs
+		room.bros.add(bro)
+		go bro.serve(rs.conn)
+	}
+	rs.byAddr[addr.String()] = room
+
+	return room, nil
+}
+
+// leave removes the bro at addr from its room, destroying the room once
+// the last bro has gone unless it is permanent. It returns the room the
+// bro left, if any.
+func (rs *Rooms) leave(addr net.Addr) *Room {
+	room, ok := rs.byAddr[addr.String()]
+	if !ok {
+		return nil
+	}
+	delete(rs.byAddr, addr.String())
+	room.bros.remove(addr)
+	if len(room.bros) == 0 && !room.permanent {
+		delete(rs.rooms, room.name)
+	}
+	return room
+}
+
+// forward queues msg for every bro in the room except the sender and
+// returns how many bros it was queued for.
+func (r *Room) forward(from net.Addr, msg []byte) int {
+	var sent int
+	for _, bro := range r.bros.otherBros(from) {
+		if bro.send(msg) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// sendTo queues msg for the bro with session alone.
+func (r *Room) sendTo(session uint32, msg []byte) bool {
+	bro, ok := r.bros.bySession(session)
+	if !ok {
+		return false
+	}
+	return bro.send(msg)
+}
+
+func (r *Room) roster() message.Peers {
+	roster := make(message.Peers, 0, len(r.bros))
+	for _, bro := range r.bros {
+		roster = append(roster, message.Peer{Session: bro.session, Name: bro.name, Color: bro.color, Codecs: bro.codecs})
+	}
+	return roster
+}
+
+// announce queues the current roster for every bro in the room.
+func (r *Room) announce() {
+	msg := message.MakeRoster(0, r.roster())
+	for _, bro := range r.bros {
+		bro.send(msg)
+	}
+}
+
+// announceLeft queues a Left event for bro to everyone still in the room,
+// followed by the updated roster.
+func (r *Room) announceLeft(bro *Bro) {
+	msg := message.MakeLeft(bro.session, bro.name)
+	for _, other := range r.bros {
+		other.send(msg)
+	}
+	r.announce()
+}
+
+// touch records that the bro at addr is still alive.
+func (rs *Rooms) touch(addr net.Addr, now time.Time) {
+	if bro, ok := rs.broAt(addr); ok {
+		bro.lastSeen = now
+	}
+}
+
+// ping queues a Ping carrying now for every bro on the server.
+func (rs *Rooms) ping(now time.Time) {
+	msg := message.MakePing(0, binary.LittleEndian.AppendUint64(nil, uint64(now.UnixMilli())))
+	for _, room := range rs.rooms {
+		for _, bro := range room.bros {
+			bro.send(msg)
+		}
+	}
+}
+
+// evict removes every bro not heard from within timeout and tells the
+// rest of its room that it left.
+func (rs *Rooms) evict(now time.Time, timeout time.Duration) []*Bro {
+	var evicted []*Bro
+	for _, room := range rs.rooms {
+		for _, bro := range room.bros {
+			if now.Sub(bro.lastSeen) > timeout {
+				evicted = append(evicted, bro)
+			}
+		}
+	}
+	for _, bro := range evicted {
+		if room := rs.leave(bro.addr); room != nil {
+			room.announceLeft(bro)
+		}
+	}
+	return evicted
+}
+
+func (rs *Rooms) roomOf(addr net.Addr) (*Room, bool) {
+	room, ok := rs.byAddr[addr.String()]
+	return room, ok
+}
+
+func (rs *Rooms) broAt(addr net.Addr) (*Bro, bool) {
+	room, ok := rs.byAddr[addr.String()]
+	if !ok {
+		return nil, false
+	}
+	bro, ok := room.bros[addr.String()]
+	return bro, ok
+}
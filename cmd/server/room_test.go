@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langlandsbrogram/asscam/pkg/message"
+)
+
+// recordingConn is a net.PacketConn that remembers who it wrote to.
+type recordingConn struct {
+	net.PacketConn
+	mu      sync.Mutex
+	written map[string]int
+}
+
+func (c *recordingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written[addr.String()]++
+	return len(b), nil
+}
+
+func (c *recordingConn) count(addr net.Addr) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.written[addr.String()]
+}
+
+func udpAddr(port int) net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+}
+
+func TestRooms(t *testing.T) {
+	t.Run("create on first join, destroy on last leave", func(t *testing.T) {
+		rooms := NewRooms(nil, RoomsConfig{Capacity: 2, AutoCreate: true, QueueSize: 1})
+
+		if _, err := rooms.join(udpAddr(1), message.Join{Room: "a", Name: "bro1"}, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := rooms.join(udpAddr(2), message.Join{Room: "b", Name: "bro2"}, 2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rooms.rooms) != 2 {
+			t.Fatalf("expected 2 rooms, got %d", len(rooms.rooms))
+		}
+
+		rooms.leave(udpAddr(1))
+		if _, ok := rooms.rooms["a"]; ok {
+			t.Errorf("expected room a to be destroyed")
+		}
+		if _, ok := rooms.roomOf(udpAddr(2)); !ok {
+			t.Errorf("expected bro2 to still be in a room")
+		}
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		rooms := NewRooms(nil, RoomsConfig{Capacity: 2, AutoCreate: true, QueueSize: 1})
+
+		rooms.join(udpAddr(1), message.Join{Room: "a", Name: "bro1"}, 1)
+		rooms.join(udpAddr(2), message.Join{Room: "a", Name: "bro2"}, 2)
+
+		if _, err := rooms.join(udpAddr(3), message.Join{Room: "a", Name: "bro3"}, 3); !errors.Is(err, errRoomFull) {
+			t.Errorf("expected errRoomFull, got %v", err)
+		}
+		if _, err := rooms.join(udpAddr(2), message.Join{Room: "a", Name: "bro2"}, 2); err != nil {
+			t.Errorf("rejoining a full room should succeed, got %v", err)
+		}
+	})
+
+	t.Run("switching rooms", func(t *testing.T) {
+		rooms := NewRooms(nil, RoomsConfig{Capacity: 2, AutoCreate: true, QueueSize: 1})
+
+		rooms.join(udpAddr(1), message.Join{Room: "a", Name: "bro1"}, 1)
+		rooms.join(udpAddr(1), message.Join{Room: "b", Name: "bro1"}, 1)
+
+		if _, ok := rooms.rooms["a"]; ok {
+			t.Errorf("expected room a to be destroyed after switching")
+		}
+		if room, _ := rooms.roomOf(udpAddr(1)); room.name != "b" {
+			t.Errorf("expected bro1 in room b, got %s", room.name)
+		}
+	})
+
+	t.Run("permanent rooms only", func(t *testing.T) {
+		rooms := NewRooms(nil, RoomsConfig{Capacity: 2, Permanent: []string{"lobby"}, QueueSize: 1})
+
+		if _, err := rooms.join(udpAddr(1), message.Join{Room: "other", Name: "bro1"}, 1); !errors.Is(err, errNoSuchRoom) {
+			t.Errorf("expected errNoSuchRoom, got %v", err)
+		}
+		rooms.join(udpAddr(1), message.Join{Room: "lobby", Name: "bro1"}, 1)
+		rooms.leave(udpAddr(1))
+		if _, ok := rooms.rooms["lobby"]; !ok {
+			t.Errorf("expected permanent room to survive last leave")
+		}
+	})
+
+	t.Run("max rooms", func(t *testing.T) {
+		rooms := NewRooms(nil, RoomsConfig{Capacity: 2, MaxRooms: 1, AutoCreate: true, QueueSize: 1})
+
+		rooms.join(udpAddr(1), message.Join{Room: "a", Name: "bro1"}, 1)
+		if _, err := rooms.join(udpAddr(2), message.Join{Room: "b", Name: "bro2"}, 2); !errors.Is(err, errTooManyRooms) {
+			t.Errorf("expected errTooManyRooms, got %v", err)
+		}
+	})
+
+	t.Run("fan out to every other bro", func(t *testing.T) {
+		conn := &recordingConn{written: make(map[string]int)}
+		rooms := NewRooms(conn, RoomsConfig{Capacity: 8, AutoCreate: true, QueueSize: 4})
+
+		for i := 1; i <= 8; i++ {
+			if _, err := rooms.join(udpAddr(i), message.Join{Room: "a", Name: "bro"}, uint32(i)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		room, _ := rooms.roomOf(udpAddr(1))
+		if sent := room.forward(udpAddr(1), []byte("frame")); sent != 7 {
+			t.Fatalf("expected 7 bros to be sent to, got %d", sent)
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for i := 2; i <= 8; i++ {
+			for conn.count(udpAddr(i)) != 1 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if conn.count(udpAddr(i)) != 1 {
+				t.Errorf("expected bro %d to receive 1 message, got %d", i, conn.count(udpAddr(i)))
+			}
+		}
+		if conn.count(udpAddr(1)) != 0 {
+			t.Errorf("sender should not receive its own message")
+		}
+	})
+
+	t.Run("send to one bro", func(t *testing.T) {
+		room := &Room{name: "a", capacity: 3, bros: NewBros()}
+		for i := 1; i <= 3; i++ {
+			room.bros.add(newBro(udpAddr(i), "bro", uint32(i), 0, 1))
+		}
+
+		if !room.sendTo(3, []byte("keyframe")) {
+			t.Fatalf("expected the message to be queued for bro 3")
+		}
+		for i := 1; i <= 3; i++ {
+			bro, _ := room.bros.bySession(uint32(i))
+			if expected := i == 3; (len(bro.queue) == 1) != expected {
+				t.Errorf("bro %d: expected queued %v, got %d messages", i, expected, len(bro.queue))
+			}
+		}
+		if room.sendTo(4, []byte("keyframe")) {
+			t.Errorf("expected no bro with session 4")
+		}
+	})
+
+	t.Run("full queue drops instead of blocking", func(t *testing.T) {
+		// built by hand so nothing drains the queue
+		room := &Room{name: "a", capacity: 2, bros: NewBros()}
+		slow := newBro(udpAddr(2), "slow", 2, 0, 1)
+		room.bros.add(newBro(udpAddr(1), "fast", 1, 0, 1))
+		room.bros.add(slow)
+
+		if sent := room.forward(udpAddr(1), []byte("1")); sent != 1 {
+			t.Fatalf("expected first message queued")
+		}
+		if sent := room.forward(udpAddr(1), []byte("2")); sent != 0 {
+			t.Fatalf("expected second message dropped")
+		}
+		if slow.dropped != 1 {
+			t.Errorf("expected 1 drop, got %d", slow.dropped)
+		}
+	})
+
+	t.Run("duplicate session", func(t *testing.T) {
+		rooms := NewRooms(nil, RoomsConfig{Capacity: 2, AutoCreate: true, QueueSize: 1})
+
+		rooms.join(udpAddr(1), message.Join{Room: "a", Name: "bro1"}, 1)
+		if _, err := rooms.join(udpAddr(2), message.Join{Room: "a", Name: "bro2"}, 1); !errors.Is(err, errSessionTaken) {
+			t.Errorf("expected errSessionTaken, got %v", err)
+		}
+	})
+
+	t.Run("evict idle bros", func(t *testing.T) {
+		conn := &recordingConn{written: make(map[string]int)}
+		rooms := NewRooms(conn, RoomsConfig{Capacity: 8, AutoCreate: true, QueueSize: 4})
+
+		rooms.join(udpAddr(1), message.Join{Room: "a", Name: "idle"}, 1)
+		rooms.join(udpAddr(2), message.Join{Room: "a", Name: "alive"}, 2)
+
+		now := time.Now()
+		idle, _ := rooms.broAt(udpAddr(1))
+		idle.lastSeen = now.Add(-time.Minute)
+		rooms.touch(udpAddr(2), now)
+
+		evicted := rooms.evict(now, 10*time.Second)
+		if len(evicted) != 1 || evicted[0] != idle {
+			t.Fatalf("expected only the idle bro to be evicted, got %v", evicted)
+		}
+		if _, ok := rooms.roomOf(udpAddr(1)); ok {
+			t.Errorf("expected idle bro to be out of its room")
+		}
+
+		// a Left followed by the updated roster
+		deadline := time.Now().Add(time.Second)
+		for conn.count(udpAddr(2)) < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if conn.count(udpAddr(2)) != 2 {
+			t.Errorf("expected remaining bro to be told, got %d messages", conn.count(udpAddr(2)))
+		}
+	})
+
+	t.Run("resume session from a new address", func(t *testing.T) {
+		rooms := NewRooms(nil, RoomsConfig{Capacity: 2, AutoCreate: true, QueueSize: 1})
+
+		rooms.join(udpAddr(1), message.Join{Room: "a", Name: "bro1"}, 1)
+		rooms.join(udpAddr(2), message.Join{Room: "a", Name: "bro2"}, 2)
+		old, _ := rooms.broAt(udpAddr(1))
+
+		if _, err := rooms.join(udpAddr(3), message.Join{Room: "a", Name: "bro1", Token: old.token + 1}, 1); !errors.Is(err, errRoomFull) {
+			t.Errorf("expected wrong token to be treated as a new bro, got %v", err)
+		}
+
+		if _, err := rooms.join(udpAddr(3), message.Join{Room: "a", Name: "bro1", Token: old.token}, 1); err != nil {
+			t.Fatalf("unexpected error resuming: %v", err)
+		}
+		if _, ok := rooms.roomOf(udpAddr(1)); ok {
+			t.Errorf("expected old address to be gone")
+		}
+		resumed, ok := rooms.broAt(udpAddr(3))
+		if !ok || resumed.session != 1 || resumed.token != old.token {
+			t.Errorf("expected session and token to carry over, got %+v", resumed)
+		}
+	})
+}
@@ -3,12 +3,12 @@ module github.com/langlandsbrogram/asscam
 go 1.22.4
 
 require (
+	github.com/ebitengine/oto/v3 v3.2.0
 	github.com/gordonklaus/portaudio v0.0.0-20230709114228-aafa478834f5
 	gocv.io/x/gocv v0.37.0
 )
 
 require (
-	github.com/ebitengine/oto/v3 v3.2.0 // indirect
 	github.com/ebitengine/purego v0.7.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 )
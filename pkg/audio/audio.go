@@ -2,12 +2,8 @@ package audio
 
 import (
 	"encoding/binary"
-	"io"
 	"math"
 	"time"
-
-	"github.com/ebitengine/oto/v3"
-	"github.com/gordonklaus/portaudio"
 )
 
 const (
@@ -15,141 +11,144 @@ const (
 	framesPerBuffer   = 120 // Approx 1/30 second of audio
 	numInputChannels  = 1
 	numOutputChannels = 0
-	volumeScaleFactor = 1
+	// outputLatency is how long audio waits in the output buffer before
+	// it is heard
+	outputLatency = 33 * time.Millisecond
 )
 
+// playerQueue is how many packets sent to Player.Input may wait to be
+// mixed.
+const playerQueue = 16
+
+// outputQueue is how many captured packets may wait on Audio.Output to be
+// sent, newer ones being dropped rather than holding up capture.
+const outputQueue = 16
+
+// Audio captures audio from a Source, processes it and numbers it into
+// packets to send on Output.
 type Audio struct {
-	stream *portaudio.Stream
-	Output chan []byte
-	buffer []float32
+	source     Source
+	Output     chan Packet
+	buffer     []float32
+	packetizer *packetizer
+	chain      Chain
 }
 
+// SetChain sets the processing captured audio goes through before it is
+// sent. Call it before Start.
+func (a *Audio) SetChain(chain Chain) {
+	a.chain = chain
+}
+
+// SuppressSilence sends comfort noise in place of the packets the VAD
+// finds no speech in. Call it before Start.
+func (a *Audio) SuppressSilence(suppress bool) {
+	a.packetizer.suppress = suppress
+}
+
+// Player mixes the packets of every sender and plays them on a Sink.
 type Player struct {
-	player *oto.Player
-	Input  chan []byte
+	sink Sink
+	// Input plays packets as if from a single sender
+	Input chan Packet
+	mixer *Mixer
+	far   *farEnd
+}
+
+// SetEchoCanceller hands what the player plays to echo, for it to cancel
+// from what the microphone picks up. Call it before Start.
+func (p *Player) SetEchoCanceller(echo *EchoCanceller) {
+	p.far.echo = echo
+}
+
+// Push plays a packet from sender, mixed with the other senders.
+func (p *Player) Push(sender uint32, packet Packet) {
+	p.mixer.Push(sender, packet, time.Now())
 }
 
-func (p *Player) Close() {
-	p.player.Close()
+// Playing returns when the audio of sender captured at captured is
+// heard, false when none of it has been played yet.
+func (p *Player) Playing(sender uint32) (captured uint64, at time.Time, ok bool) {
+	return p.mixer.Playing(sender)
+}
+
+// Speaking reports whether sender is sending speech rather than
+// silence.
+func (p *Player) Speaking(sender uint32) bool {
+	return p.mixer.Speaking(sender)
+}
+
+// Remove stops playing sender.
+func (p *Player) Remove(sender uint32) {
+	p.mixer.Remove(sender)
+}
+
+func (p *Player) Close() error {
+	return p.sink.Close()
 }
 
 func (p *Player) Start() {
-	p.player.Play()
+	p.sink.Play(p.far)
 }
 
-func (a *Audio) Close() {
-	a.stream.Stop()
-	a.stream.Close()
-	portaudio.Terminate()
+func (a *Audio) Close() error {
+	return a.source.Close()
 }
 
+// Start captures until the source fails, returning io.EOF once it runs
+// out.
 func (a *Audio) Start() error {
 	for {
-		err := a.stream.Read()
+		err := a.source.Read(a.buffer)
 		if err != nil {
 			return err
 		}
+		// the buffer was being filled for as long as it plays
+		captured := time.Now().Add(-time.Duration(len(a.buffer)) * time.Second / sampleRate)
+		a.chain.Process(a.buffer)
 		pcm := float32ToPCM(a.buffer)
-		a.Output <- pcm
+		if packet, ok := a.packetizer.next(pcm, captured); ok {
+			select {
+			case a.Output <- packet:
+			default:
+				// the packet is lost, as if on the way
+			}
+		}
 	}
 }
 
-func NewAudio() (*Audio, error) {
-	err := portaudio.Initialize()
-	if err != nil {
-		return nil, err
-	}
-
-	buffer := make([]float32, framesPerBuffer)
-	stream, err := portaudio.OpenDefaultStream(
-		numInputChannels,
-		numOutputChannels,
-		sampleRate,
-		framesPerBuffer,
-		buffer,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	err = stream.Start()
-	if err != nil {
-		return nil, err
-	}
-
+func NewAudio(source Source) *Audio {
 	return &Audio{
-		buffer: buffer,
-		Output: make(chan []byte),
-		stream: stream,
-	}, nil
-
-}
-func NewPlayer() (*Player, error) {
-	op := &oto.NewContextOptions{
-		SampleRate:   sampleRate,
-		ChannelCount: 1,
-		Format:       oto.FormatSignedInt16LE,
-		BufferSize:   time.Duration(33 * time.Millisecond),
-	}
-	otoCtx, readyChan, err := oto.NewContext(op)
-	if err != nil {
-		return nil, err
-	}
-	<-readyChan
-
-	c := make(chan []byte)
-	reader := NewAudioBufferReader(c)
-	player := otoCtx.NewPlayer(reader)
-
-	return &Player{
-		player: player,
-		Input:  c,
-	}, nil
-
-}
-
-type AudioBufferReader struct {
-	buffer []byte
-	stream <-chan []byte
-}
-
-func NewAudioBufferReader(stream <-chan []byte) *AudioBufferReader {
-	return &AudioBufferReader{
-		stream: stream,
+		source:     source,
+		buffer:     make([]float32, framesPerBuffer),
+		Output:     make(chan Packet, outputQueue),
+		packetizer: newPacketizer(),
+		chain:      Chain{Limiter{}},
 	}
 }
 
-func (r *AudioBufferReader) Read(b []byte) (int, error) {
-
-	if len(r.buffer) == 0 {
-		data, ok := <-r.stream
-		if !ok {
-			return 0, io.EOF
+func NewPlayer(sink Sink) *Player {
+	c := make(chan Packet, playerQueue)
+	mixer := NewMixer()
+	go func() {
+		for p := range c {
+			mixer.Push(0, p, time.Now())
 		}
-		// var loud bool
-		// for i := range data {
-		// 	if data[i] > 0.3 {
-		// 		loud = true
-		// 	}
-		// }
-		// if loud {
-		// 	fmt.Println("[IN] loud")
-		// }
-		r.buffer = data
-	}
-
-	n := copy(b, r.buffer)
-
-	r.buffer = r.buffer[n:]
-
-	return n, nil
+	}()
 
+	return &Player{
+		sink:  sink,
+		Input: c,
+		mixer: mixer,
+		far:   &farEnd{r: mixer},
+	}
 }
 
 func float32ToPCM(buffer []float32) []byte {
 	pcm := make([]byte, len(buffer)*2) // 2 bytes per sample for int16
 	for i, sample := range buffer {
-		sample = sample * volumeScaleFactor
+		// the limiter keeps samples in range, this only guards the
+		// conversion
 		sample = clampBetweenOne(sample)
 		intSample := int16(sample * math.MaxInt16)
 		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(intSample))
@@ -1,3 +1,5 @@
+//go:build cgo && !noportaudio
+
 package audio
 
 import (
@@ -6,16 +8,18 @@ import (
 )
 
 func TestAudioPlayerIntegration(t *testing.T) {
-	audio, err := NewAudio()
+	mic, err := OpenSource("mic")
 	if err != nil {
 		t.Fatalf("Error initializing audio: %v", err)
 	}
+	audio := NewAudio(mic)
 	defer audio.Close()
 
-	player, err := NewPlayer()
+	speaker, err := OpenSink("speaker")
 	if err != nil {
 		t.Fatalf("Error initializing player: %v", err)
 	}
+	player := NewPlayer(speaker)
 	defer player.Close()
 
 	go func() {
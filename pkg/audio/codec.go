@@ -0,0 +1,331 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Codec is how the samples of a Packet are sent.
+type Codec uint8
+
+const (
+	// PCM sends the 16 bit samples as they are
+	PCM Codec = iota
+	// MuLaw and ALaw are the two flavours of G.711, 8 bits a sample
+	MuLaw
+	ALaw
+	// ADPCM is IMA ADPCM, 4 bits a sample
+	ADPCM
+	// ComfortNoise marks a packet sent in place of silence, carrying
+	// only the level of the noise to play until speech comes back
+	ComfortNoise Codec = 255
+)
+
+// Supported has a bit set for every codec this build can decode, for
+// bros to tell each other when joining.
+const Supported = 1<<PCM | 1<<MuLaw | 1<<ALaw | 1<<ADPCM
+
+// codec turns 16 bit little endian PCM samples into what is sent and
+// back.
+type codec interface {
+	encode(pcm []byte) []byte
+	decode(data []byte) ([]byte, error)
+}
+
+var codecs = map[Codec]codec{
+	PCM:   pcmCodec{},
+	MuLaw: g711{muLawEncode, muLawDecode},
+	ALaw:  g711{aLawEncode, aLawDecode},
+	ADPCM: adpcm{},
+}
+
+func (c Codec) String() string {
+	switch c {
+	case PCM:
+		return "pcm"
+	case MuLaw:
+		return "mulaw"
+	case ALaw:
+		return "alaw"
+	case ADPCM:
+		return "adpcm"
+	case ComfortNoise:
+		return "comfort noise"
+	default:
+		return fmt.Sprintf("codec %d", uint8(c))
+	}
+}
+
+// ParseCodec reads a -codec flag value.
+func ParseCodec(s string) (Codec, error) {
+	for c := range codecs {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return PCM, fmt.Errorf("unknown codec %q", s)
+}
+
+// Negotiate returns preferred when every peer, by the Supported bits it
+// joined with, can decode it and PCM when one cannot.
+func Negotiate(preferred Codec, peers []uint8) Codec {
+	for _, supported := range peers {
+		if supported&(1<<preferred) == 0 {
+			return PCM
+		}
+	}
+	return preferred
+}
+
+// Encode turns 16 bit little endian PCM samples into what is sent,
+// leaving them as they are for an unknown codec.
+func (c Codec) Encode(pcm []byte) []byte {
+	if codec, ok := codecs[c]; ok {
+		return codec.encode(pcm)
+	}
+	return pcm
+}
+
+// Decode turns what was sent back into 16 bit little endian PCM samples.
+func (c Codec) Decode(data []byte) ([]byte, error) {
+	codec, ok := codecs[c]
+	if !ok {
+		return nil, errors.New("unknown audio codec")
+	}
+	return codec.decode(data)
+}
+
+type pcmCodec struct{}
+
+func (pcmCodec) encode(pcm []byte) []byte {
+	return pcm
+}
+
+func (pcmCodec) decode(data []byte) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, errors.New("pcm data truncated")
+	}
+	return data, nil
+}
+
+// g711 codecs turn every sample into a byte on their own.
+type g711 struct {
+	compress func(int16) byte
+	expand   func(byte) int16
+}
+
+func (g g711) encode(pcm []byte) []byte {
+	data := make([]byte, len(pcm)/2)
+	for i := range data {
+		data[i] = g.compress(int16(binary.LittleEndian.Uint16(pcm[2*i:])))
+	}
+	return data
+}
+
+func (g g711) decode(data []byte) ([]byte, error) {
+	pcm := make([]byte, 2*len(data))
+	for i, b := range data {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(g.expand(b)))
+	}
+	return pcm, nil
+}
+
+const (
+	muLawBias = 0x84
+	muLawClip = 32635
+)
+
+func muLawEncode(s int16) byte {
+	x := int(s)
+	var sign byte
+	if x < 0 {
+		x, sign = -x, 0x80
+	}
+	x = min(x, muLawClip) + muLawBias
+
+	exponent := 7
+	for mask := 0x4000; x&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (x >> (exponent + 3)) & 0x0f
+	return ^(sign | byte(exponent<<4) | byte(mantissa))
+}
+
+func muLawDecode(b byte) int16 {
+	b = ^b
+	exponent := int(b>>4) & 0x07
+	mantissa := int(b & 0x0f)
+	x := (mantissa<<3+muLawBias)<<exponent - muLawBias
+	if b&0x80 != 0 {
+		return int16(-x)
+	}
+	return int16(x)
+}
+
+func aLawEncode(s int16) byte {
+	x := int(s) >> 3
+	mask := byte(0xd5)
+	if x < 0 {
+		x, mask = -x-1, 0x55
+	}
+
+	segment := 0
+	for segment < 8 && x >= 0x20<<segment {
+		segment++
+	}
+	if segment == 8 {
+		return 0x7f ^ mask
+	}
+	b := byte(segment << 4)
+	if segment < 2 {
+		b |= byte(x>>1) & 0x0f
+	} else {
+		b |= byte(x>>segment) & 0x0f
+	}
+	return b ^ mask
+}
+
+func aLawDecode(b byte) int16 {
+	b ^= 0x55
+	x := int(b&0x0f) << 4
+	switch segment := int(b&0x70) >> 4; segment {
+	case 0:
+		x += 8
+	case 1:
+		x += 0x108
+	default:
+		x = (x + 0x108) << (segment - 1)
+	}
+	if b&0x80 != 0 {
+		return int16(x)
+	}
+	return int16(-x)
+}
+
+var (
+	adpcmSteps = [89]int{
+		7, 8, 9, 10, 11, 12, 13, 14, 16, 17, 19, 21, 23, 25, 28, 31, 34, 37,
+		41, 45, 50, 55, 60, 66, 73, 80, 88, 97, 107, 118, 130, 143, 157, 173,
+		190, 209, 230, 253, 279, 307, 337, 371, 408, 449, 494, 544, 598, 658,
+		724, 796, 876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+		2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358, 5894,
+		6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899, 15289,
+		16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+	}
+	adpcmIndices = [8]int{-1, -1, -1, -1, 2, 4, 6, 8}
+)
+
+// adpcm packs every sample into a nibble, each packet on its own so a
+// lost one does not throw the next off. A packet is laid out as
+// [first sample int16][step index][padded] followed by the nibbles, low
+// one first, padded being 1 when the last nibble is not a sample.
+type adpcm struct{}
+
+// adpcmState is what encoder and decoder track from sample to sample.
+type adpcmState struct {
+	predicted int
+	index     int
+}
+
+// next moves the state on by nibble, returning the sample it stands for.
+func (s *adpcmState) next(nibble byte) int16 {
+	step := adpcmSteps[s.index]
+	delta := step >> 3
+	if nibble&4 != 0 {
+		delta += step
+	}
+	if nibble&2 != 0 {
+		delta += step >> 1
+	}
+	if nibble&1 != 0 {
+		delta += step >> 2
+	}
+	if nibble&8 != 0 {
+		delta = -delta
+	}
+	s.predicted = min(max(s.predicted+delta, -32768), 32767)
+	s.index = min(max(s.index+adpcmIndices[nibble&7], 0), len(adpcmSteps)-1)
+	return int16(s.predicted)
+}
+
+func (adpcm) encode(pcm []byte) []byte {
+	n := len(pcm) / 2
+	if n == 0 {
+		return make([]byte, 4)
+	}
+	sample := func(i int) int {
+		return int(int16(binary.LittleEndian.Uint16(pcm[2*i:])))
+	}
+
+	// start at the step the first change needs rather than the smallest
+	state := adpcmState{predicted: sample(0)}
+	if n > 1 {
+		change := abs(sample(1) - sample(0))
+		for state.index < len(adpcmSteps)-1 && adpcmSteps[state.index] < change {
+			state.index++
+		}
+	}
+
+	data := make([]byte, 4, 4+(n+1)/2)
+	binary.LittleEndian.PutUint16(data, uint16(state.predicted))
+	data[2] = byte(state.index)
+	data[3] = byte(n % 2)
+	for i := range n {
+		diff := sample(i) - state.predicted
+		var nibble byte
+		if diff < 0 {
+			nibble, diff = 8, -diff
+		}
+		step := adpcmSteps[state.index]
+		for bit := byte(4); bit > 0; bit >>= 1 {
+			if diff >= step {
+				nibble |= bit
+				diff -= step
+			}
+			step >>= 1
+		}
+		state.next(nibble)
+
+		if i%2 == 0 {
+			data = append(data, nibble)
+		} else {
+			data[len(data)-1] |= nibble << 4
+		}
+	}
+	return data
+}
+
+func (adpcm) decode(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("adpcm data too small")
+	}
+	if data[3] > 1 {
+		return nil, errors.New("adpcm padding invalid")
+	}
+	if int(data[2]) >= len(adpcmSteps) {
+		return nil, errors.New("adpcm step index out of range")
+	}
+	state := adpcmState{
+		predicted: int(int16(binary.LittleEndian.Uint16(data))),
+		index:     int(data[2]),
+	}
+	n := 2*(len(data)-4) - int(data[3])
+	if n < 0 {
+		return nil, errors.New("adpcm data truncated")
+	}
+
+	pcm := make([]byte, 2*n)
+	for i := range n {
+		nibble := data[4+i/2] >> (4 * (i % 2)) & 0x0f
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(state.next(nibble)))
+	}
+	return pcm, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
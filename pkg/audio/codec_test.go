@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// snr returns how far above the difference between them want is from
+// got, in dB.
+func snr(want, got []byte) float64 {
+	var signal, noise float64
+	for i := 0; i+1 < len(want); i += 2 {
+		x := float64(int16(binary.LittleEndian.Uint16(want[i:])))
+		y := float64(int16(binary.LittleEndian.Uint16(got[i:])))
+		signal += x * x
+		noise += (x - y) * (x - y)
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestCodecs(t *testing.T) {
+	pcm := append(tone(0).PCM, tone(1).PCM...)
+	for _, test := range []struct {
+		codec Codec
+		size  int
+		snr   float64
+	}{
+		{PCM, len(pcm), math.Inf(1)},
+		{MuLaw, len(pcm) / 2, 30},
+		{ALaw, len(pcm) / 2, 30},
+		{ADPCM, 4 + len(pcm)/4, 20},
+	} {
+		t.Run(test.codec.String(), func(t *testing.T) {
+			data := test.codec.Encode(pcm)
+			if len(data) != test.size {
+				t.Errorf("expected %d bytes, got %d", test.size, len(data))
+			}
+			decoded, err := test.codec.Decode(data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(decoded) != len(pcm) {
+				t.Fatalf("expected %d bytes decoded, got %d", len(pcm), len(decoded))
+			}
+			if got := snr(pcm, decoded); got < test.snr {
+				t.Errorf("expected a signal to noise ratio of %.0fdB, got %.1fdB", test.snr, got)
+			}
+		})
+	}
+
+	t.Run("odd adpcm", func(t *testing.T) {
+		decoded, err := ADPCM.Decode(ADPCM.Encode(pcm[:6]))
+		if err != nil || len(decoded) != 6 {
+			t.Errorf("expected 3 samples, got %d bytes, %v", len(decoded), err)
+		}
+	})
+
+	t.Run("g711 extremes", func(t *testing.T) {
+		for _, s := range []int16{math.MaxInt16, math.MinInt16, 0, -1} {
+			if got := muLawDecode(muLawEncode(s)); math.Abs(float64(got)-float64(s)) > 1024 {
+				t.Errorf("mulaw %d: got %d", s, got)
+			}
+			if got := aLawDecode(aLawEncode(s)); math.Abs(float64(got)-float64(s)) > 1024 {
+				t.Errorf("alaw %d: got %d", s, got)
+			}
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := Codec(200).Decode(pcm); err == nil {
+			t.Errorf("expected error for an unknown codec")
+		}
+	})
+}
+
+func TestParseCodec(t *testing.T) {
+	for c := range codecs {
+		if parsed, err := ParseCodec(c.String()); err != nil || parsed != c {
+			t.Errorf("Expected: %s\nGot: %s %v", c, parsed, err)
+		}
+	}
+	if _, err := ParseCodec("mp3"); err == nil {
+		t.Errorf("expected error for mp3")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	if got := Negotiate(ADPCM, []uint8{Supported, Supported}); got != ADPCM {
+		t.Errorf("Expected: %s\nGot: %s", ADPCM, got)
+	}
+	if got := Negotiate(ADPCM, []uint8{Supported, 1<<PCM | 1<<MuLaw}); got != PCM {
+		t.Errorf("Expected: %s\nGot: %s", PCM, got)
+	}
+	if got := Negotiate(MuLaw, nil); got != MuLaw {
+		t.Errorf("Expected: %s\nGot: %s", MuLaw, got)
+	}
+}
+
+func TestPacket(t *testing.T) {
+	for c := range codecs {
+		p := tone(3)
+		p.Captured = 1 << 40
+		p.Codec = c
+
+		var decoded Packet
+		if err := decoded.Decode(p.Encode()); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c, err)
+		}
+		if c == PCM && !reflect.DeepEqual(decoded, p) {
+			t.Errorf("%s\nExpected: %+v\nGot: %+v", c, p, decoded)
+		}
+		if decoded.Seq != p.Seq || decoded.Timestamp != p.Timestamp ||
+			decoded.Captured != p.Captured || decoded.Codec != c || len(decoded.PCM) != len(p.PCM) {
+			t.Errorf("%s: header mismatch\nExpected: %d %d %d\nGot: %d %d %d", c,
+				p.Seq, p.Timestamp, p.Captured, decoded.Seq, decoded.Timestamp, decoded.Captured)
+		}
+	}
+
+	var p Packet
+	if err := p.Decode(make([]byte, 14)); err == nil {
+		t.Errorf("expected error for a truncated packet")
+	}
+}
@@ -0,0 +1,95 @@
+//go:build cgo && !noportaudio
+
+package audio
+
+import (
+	"io"
+
+	"github.com/ebitengine/oto/v3"
+	"github.com/gordonklaus/portaudio"
+)
+
+// micSource captures the default microphone through PortAudio, a buffer
+// of framesPerBuffer samples at a time.
+type micSource struct {
+	stream *portaudio.Stream
+	buffer []float32
+}
+
+func newMicSource() (Source, error) {
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := make([]float32, framesPerBuffer)
+	stream, err := portaudio.OpenDefaultStream(
+		numInputChannels,
+		numOutputChannels,
+		sampleRate,
+		framesPerBuffer,
+		buffer,
+	)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+
+	err = stream.Start()
+	if err != nil {
+		stream.Close()
+		portaudio.Terminate()
+		return nil, err
+	}
+
+	return &micSource{stream: stream, buffer: buffer}, nil
+}
+
+func (s *micSource) Read(samples []float32) error {
+	err := s.stream.Read()
+	// an overflow lost samples before these, which still came through
+	if err != nil && err != portaudio.InputOverflowed {
+		return err
+	}
+	copy(samples, s.buffer)
+	return nil
+}
+
+func (s *micSource) Close() error {
+	s.stream.Stop()
+	s.stream.Close()
+	return portaudio.Terminate()
+}
+
+// speakerSink plays on the default speakers through oto.
+type speakerSink struct {
+	ctx    *oto.Context
+	player *oto.Player
+}
+
+func newSpeakerSink() (Sink, error) {
+	op := &oto.NewContextOptions{
+		SampleRate:   sampleRate,
+		ChannelCount: 1,
+		Format:       oto.FormatSignedInt16LE,
+		BufferSize:   outputLatency,
+	}
+	otoCtx, readyChan, err := oto.NewContext(op)
+	if err != nil {
+		return nil, err
+	}
+	<-readyChan
+	return &speakerSink{ctx: otoCtx}, nil
+}
+
+func (s *speakerSink) Play(r io.Reader) {
+	s.player = s.ctx.NewPlayer(r)
+	s.player.Play()
+}
+
+func (s *speakerSink) Close() error {
+	if s.player == nil {
+		return nil
+	}
+	return s.player.Close()
+}
@@ -0,0 +1,15 @@
+//go:build !cgo || noportaudio
+
+package audio
+
+import "errors"
+
+var errNoDevices = errors.New("built without PortAudio; the mic source and speaker sink are unavailable")
+
+func newMicSource() (Source, error) {
+	return nil, errNoDevices
+}
+
+func newSpeakerSink() (Sink, error) {
+	return nil, errNoDevices
+}
@@ -0,0 +1,195 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// gateHold is how long the gate stays open after the sound drops
+	// below its threshold, and gateRelease how long it then takes to close
+	gateHold    = 100 * time.Millisecond
+	gateRelease = 50 * time.Millisecond
+	// gateAttack is how long the gate takes to open
+	gateAttack = time.Millisecond
+	// agcWindow is how long the AGC measures loudness over, and agcSpeed
+	// how long it takes to move its gain to match
+	agcWindow = 300 * time.Millisecond
+	agcSpeed  = 500 * time.Millisecond
+	// agcOnset is how long the AGC measures loudness over to tell sound
+	// from the tail of what came before, which it holds its gain through
+	agcOnset = 20 * time.Millisecond
+	// agcTail is how far below the loudness over agcWindow the loudness
+	// over agcOnset drops in the tail of a sound, in dB
+	agcTail = 10.0
+	// agcMinLevel is the loudness below which the AGC holds its gain
+	// rather than turn silence up
+	agcMinLevel = -55.0
+	// agcMaxGain and agcMinGain bound the gain of the AGC, in dB
+	agcMaxGain = 30.0
+	agcMinGain = -20.0
+	// limiterKnee is where the limiter starts to bend samples down, in
+	// full scale
+	limiterKnee = 0.8
+)
+
+// Stage is one step of processing captured audio, changing a buffer of
+// samples in place.
+type Stage interface {
+	Process(samples []float32)
+}
+
+// Chain runs its stages one after the other.
+type Chain []Stage
+
+func (c Chain) Process(samples []float32) {
+	for _, s := range c {
+		s.Process(samples)
+	}
+}
+
+// ChainConfig picks the stages of NewChain, zero turning a stage off.
+type ChainConfig struct {
+	// HighPass is the cutoff of the high-pass filter, in Hz
+	HighPass float64
+	// Gate is the threshold of the noise gate, in dBFS peak
+	Gate float64
+	// Target is the loudness the AGC aims for, in dBFS RMS
+	Target float64
+}
+
+// NewChain returns a high-pass filter, noise gate and AGC as configured,
+// followed by a limiter.
+func NewChain(config ChainConfig) Chain {
+	var chain Chain
+	if config.HighPass > 0 {
+		chain = append(chain, NewHighPass(config.HighPass))
+	}
+	if config.Gate < 0 {
+		chain = append(chain, NewNoiseGate(config.Gate))
+	}
+	if config.Target < 0 {
+		chain = append(chain, NewAGC(config.Target))
+	}
+	return append(chain, Limiter{})
+}
+
+// coefficient returns how much of the way to a new value a smoothed one
+// moves every sample to get most of the way there in d.
+func coefficient(d time.Duration) float64 {
+	return 1 - math.Exp(-1/(d.Seconds()*sampleRate))
+}
+
+// fromDB turns dB into a factor, dBFS into full scale.
+func fromDB(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// HighPass is a first order high-pass filter, taking out hum, rumble and
+// the DC offset of cheap microphones.
+type HighPass struct {
+	a      float64
+	lastIn float64
+	last   float64
+}
+
+func NewHighPass(cutoff float64) *HighPass {
+	rc := 1 / (2 * math.Pi * cutoff)
+	return &HighPass{a: rc / (rc + 1.0/sampleRate)}
+}
+
+func (h *HighPass) Process(samples []float32) {
+	for i, s := range samples {
+		x := float64(s)
+		h.last = h.a * (h.last + x - h.lastIn)
+		h.lastIn = x
+		samples[i] = float32(h.last)
+	}
+}
+
+// NoiseGate silences what peaks below its threshold, opening fast for
+// sound above it and closing slowly once it has been below for a while.
+type NoiseGate struct {
+	threshold float64
+	// envelope follows the peaks of the samples
+	envelope float64
+	gain     float64
+	// held counts the samples since the sound was above the threshold
+	held int
+}
+
+func NewNoiseGate(threshold float64) *NoiseGate {
+	return &NoiseGate{threshold: fromDB(threshold)}
+}
+
+func (g *NoiseGate) Process(samples []float32) {
+	fall := 1 - coefficient(gateRelease)
+	attack, release := coefficient(gateAttack), coefficient(gateRelease)
+	hold := int(gateHold.Seconds() * sampleRate)
+	for i, s := range samples {
+		g.envelope = max(math.Abs(float64(s)), g.envelope*fall)
+		if g.envelope > g.threshold {
+			g.held = 0
+		} else {
+			g.held++
+		}
+
+		if g.held < hold {
+			g.gain += (1 - g.gain) * attack
+		} else {
+			g.gain -= g.gain * release
+		}
+		samples[i] = float32(float64(s) * g.gain)
+	}
+}
+
+// AGC turns the gain up or down to bring the loudness of what it hears
+// to a target, holding it through silence and the tails of sounds.
+type AGC struct {
+	target float64
+	// power is the mean square of the samples over the last agcWindow,
+	// onset over the last agcOnset
+	power float64
+	onset float64
+	gain  float64
+}
+
+func NewAGC(target float64) *AGC {
+	return &AGC{target: fromDB(target), gain: 1}
+}
+
+func (a *AGC) Process(samples []float32) {
+	window, onset, speed := coefficient(agcWindow), coefficient(agcOnset), coefficient(agcSpeed)
+	minPower, tail := fromDB(2*agcMinLevel), fromDB(-2*agcTail)
+	minGain, maxGain := fromDB(agcMinGain), fromDB(agcMaxGain)
+	for i, s := range samples {
+		x := float64(s)
+		a.power += (x*x - a.power) * window
+		a.onset += (x*x - a.onset) * onset
+		if a.onset > minPower && a.onset > a.power*tail {
+			want := min(max(a.target/math.Sqrt(a.power), minGain), maxGain)
+			a.gain += (want - a.gain) * speed
+		}
+		samples[i] = float32(x * a.gain)
+	}
+}
+
+// Limiter keeps samples within full scale, passing them as they are up
+// to limiterKnee and bending them smoothly towards full scale past it
+// rather than clipping.
+type Limiter struct{}
+
+func (Limiter) Process(samples []float32) {
+	for i, s := range samples {
+		samples[i] = float32(limit(float64(s)))
+	}
+}
+
+func limit(x float64) float64 {
+	magnitude := math.Abs(x)
+	if magnitude <= limiterKnee {
+		return x
+	}
+	headroom := 1 - limiterKnee
+	return math.Copysign(limiterKnee+headroom*math.Tanh((magnitude-limiterKnee)/headroom), x)
+}
@@ -0,0 +1,166 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// sine returns d of a sine of freq Hz and amplitude a.
+func sine(freq, a float64, d time.Duration) []float32 {
+	samples := make([]float32, int(d.Seconds()*sampleRate))
+	for i := range samples {
+		samples[i] = float32(a * math.Sin(2*math.Pi*freq*float64(i)/sampleRate))
+	}
+	return samples
+}
+
+// level returns the loudness of samples in dBFS RMS.
+func level(samples []float32) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return 10 * math.Log10(sum/float64(len(samples)))
+}
+
+// sineLevel is the loudness of a sine of amplitude a in dBFS RMS.
+func sineLevel(a float64) float64 {
+	return 20 * math.Log10(a/math.Sqrt2)
+}
+
+// process runs stage over samples a packet at a time, the way captured
+// audio goes through it.
+func process(stage Stage, samples []float32) []float32 {
+	for i := 0; i < len(samples); i += framesPerBuffer {
+		stage.Process(samples[i:min(i+framesPerBuffer, len(samples))])
+	}
+	return samples
+}
+
+// tail returns the last d of samples.
+func tail(samples []float32, d time.Duration) []float32 {
+	return samples[len(samples)-int(d.Seconds()*sampleRate):]
+}
+
+func TestHighPass(t *testing.T) {
+	for _, test := range []struct {
+		freq     float64
+		min, max float64
+	}{
+		{1000, -0.5, 0},
+		{300, -1, 0},
+		{20, -20, -10},
+		{0, math.Inf(-1), -40},
+	} {
+		samples := sine(test.freq, 0.5, time.Second)
+		if test.freq == 0 {
+			for i := range samples {
+				samples[i] = 0.5
+			}
+		}
+		out := process(NewHighPass(80), samples)
+		gain := level(tail(out, 500*time.Millisecond)) - sineLevel(0.5)
+		if gain < test.min || gain > test.max {
+			t.Errorf("%.0fHz: expected a gain of %.1f to %.1fdB, got %.1fdB", test.freq, test.min, test.max, gain)
+		}
+	}
+}
+
+func TestNoiseGate(t *testing.T) {
+	t.Run("passes sound", func(t *testing.T) {
+		out := process(NewNoiseGate(-50), sine(440, 0.1, time.Second))
+		if got := level(tail(out, 500*time.Millisecond)); math.Abs(got-sineLevel(0.1)) > 0.1 {
+			t.Errorf("Expected: %.1fdBFS\nGot: %.1fdBFS", sineLevel(0.1), got)
+		}
+	})
+
+	t.Run("silences noise", func(t *testing.T) {
+		out := process(NewNoiseGate(-50), sine(440, 0.001, time.Second))
+		if got := level(tail(out, 500*time.Millisecond)); got > -120 {
+			t.Errorf("expected silence, got %.1fdBFS", got)
+		}
+	})
+
+	t.Run("holds open", func(t *testing.T) {
+		g := NewNoiseGate(-50)
+		process(g, sine(440, 0.1, time.Second))
+		// quieter than the threshold, but within the hold
+		out := process(g, sine(440, 0.001, gateHold/2))
+		if got := level(out); math.Abs(got-sineLevel(0.001)) > 1 {
+			t.Errorf("Expected: %.1fdBFS\nGot: %.1fdBFS", sineLevel(0.001), got)
+		}
+	})
+}
+
+func TestAGC(t *testing.T) {
+	for _, in := range []float64{-40, -20, -6} {
+		out := process(NewAGC(-20), sine(440, fromDB(in), 3*time.Second))
+		if got := level(tail(out, 500*time.Millisecond)); math.Abs(got+20) > 1 {
+			t.Errorf("%.0fdBFS in\nExpected: -20dBFS\nGot: %.1fdBFS", in, got)
+		}
+	}
+
+	t.Run("holds through silence", func(t *testing.T) {
+		a := NewAGC(-20)
+		process(a, sine(440, fromDB(-30), 3*time.Second))
+		gain := a.gain
+		process(a, sine(440, fromDB(-80), 3*time.Second))
+		if drift := 20 * math.Log10(a.gain/gain); math.Abs(drift) > 1 {
+			t.Errorf("expected the gain held at %.2f, got %.2f", gain, a.gain)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		a := NewAGC(-20)
+		process(a, sine(440, fromDB(-54), 10*time.Second))
+		if db := 20 * math.Log10(a.gain); db > agcMaxGain+0.01 {
+			t.Errorf("expected at most %.0fdB of gain, got %.1fdB", agcMaxGain, db)
+		}
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	last := -math.MaxFloat64
+	for x := -4.0; x <= 4; x += 0.01 {
+		y := limit(x)
+		if math.Abs(y) > 1 {
+			t.Fatalf("%.2f: expected within full scale, got %f", x, y)
+		}
+		if y < last {
+			t.Fatalf("%.2f: expected %f to be above %f", x, y, last)
+		}
+		if math.Abs(x) <= limiterKnee && y != x {
+			t.Fatalf("%.2f: expected it unchanged below the knee, got %f", x, y)
+		}
+		last = y
+	}
+}
+
+func TestChain(t *testing.T) {
+	chain := NewChain(ChainConfig{HighPass: 80, Gate: -50, Target: -20})
+	if len(chain) != 4 {
+		t.Fatalf("expected 4 stages, got %d", len(chain))
+	}
+	if _, ok := chain[len(chain)-1].(Limiter); !ok {
+		t.Errorf("expected the limiter last, got %T", chain[len(chain)-1])
+	}
+	if chain := NewChain(ChainConfig{}); len(chain) != 1 {
+		t.Errorf("expected only the limiter, got %d stages", len(chain))
+	}
+
+	// hum, then a quiet voice over it
+	samples := append(sine(50, 0.2, time.Second), sine(440, 0.02, 2*time.Second)...)
+	for i := range samples {
+		samples[i] += float32(0.2 * math.Sin(2*math.Pi*50*float64(i)/sampleRate))
+	}
+	out := process(chain, samples)
+	for _, s := range out {
+		if s > 1 || s < -1 {
+			t.Fatalf("expected within full scale, got %f", s)
+		}
+	}
+	if got := level(tail(out, 500*time.Millisecond)); math.Abs(got+20) > 2 {
+		t.Errorf("Expected: -20dBFS\nGot: %.1fdBFS", got)
+	}
+}
@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// echoTail is the longest echo cancelled: the output and input
+	// latency plus the echoes of the room
+	echoTail = 128 * time.Millisecond
+	// echoStep is how far the filter adapts to every sample, between 0
+	// and 2, faster but noisier towards 2
+	echoStep = 0.5
+	// echoMaxPending caps the far-end samples waiting for the captured
+	// ones they were heard in, in case capture stops
+	echoMaxPending = sampleRate / 2
+	// doubleTalk is how loud the captured sound is against the loudest
+	// far-end sample it could be an echo of before it is taken for the
+	// near end talking, which the filter must not adapt to
+	doubleTalk = 0.6
+	// doubleTalkHold is how long adapting stays off after double talk
+	doubleTalkHold = 30 * time.Millisecond
+)
+
+// EchoCanceller takes the far end, what the speakers play, out of what
+// the microphone captures with it. An NLMS adaptive filter learns how
+// the far end reaches the microphone and subtracts its estimate of the
+// echo from every captured sample.
+//
+// It is a Stage, to go first in the chain captured audio goes through,
+// and is fed the far end with Far as it is played.
+type EchoCanceller struct {
+	mu sync.Mutex
+	// pending is the far end played but not yet matched with the
+	// captured samples it was heard in
+	pending []float32
+	// far holds the last taps far-end samples twice over, from pos, so
+	// they can be read in one piece oldest first
+	far     []float64
+	pos     int
+	taps    int
+	power   float64
+	weights []float64
+	// held counts down the samples left of not adapting after double talk
+	held int
+}
+
+func NewEchoCanceller() *EchoCanceller {
+	taps := int(echoTail.Seconds() * sampleRate)
+	return &EchoCanceller{
+		far:     make([]float64, 2*taps),
+		taps:    taps,
+		weights: make([]float64, taps),
+	}
+}
+
+// Far adds far-end samples, in the order they are played.
+func (e *EchoCanceller) Far(samples []float32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append(e.pending, samples...)
+	if over := len(e.pending) - echoMaxPending; over > 0 {
+		e.pending = e.pending[over:]
+	}
+}
+
+// Process cancels the echo of the far end in captured samples, matching
+// each with the next far-end sample played, silence when there is none.
+func (e *EchoCanceller) Process(samples []float32) {
+	e.mu.Lock()
+	n := min(len(samples), len(e.pending))
+	far := make([]float32, len(samples))
+	copy(far, e.pending[:n])
+	e.pending = e.pending[n:]
+	e.mu.Unlock()
+
+	hold := int(doubleTalkHold.Seconds() * sampleRate)
+	// the loudest far-end sample of the window, give or take the few
+	// that leave it while processing samples
+	var peak float64
+	for _, x := range e.far[e.pos : e.pos+e.taps] {
+		peak = max(peak, math.Abs(x))
+	}
+	for i, s := range samples {
+		x := e.push(float64(far[i]))
+		peak = max(peak, math.Abs(float64(far[i])))
+
+		var echo float64
+		for k, w := range e.weights {
+			echo += w * x[k]
+		}
+		near := float64(s)
+		residual := near - echo
+		samples[i] = float32(residual)
+
+		if math.Abs(near) > doubleTalk*peak {
+			e.held = hold
+		}
+		if e.held > 0 {
+			e.held--
+			continue
+		}
+		if e.power > 0 {
+			step := echoStep * residual / (e.power + 1e-6)
+			for k := range e.weights {
+				e.weights[k] += step * x[k]
+			}
+		}
+	}
+}
+
+// push adds a far-end sample, returning the last taps of them, oldest
+// first.
+func (e *EchoCanceller) push(sample float64) []float64 {
+	old := e.far[e.pos]
+	e.power = max(e.power+sample*sample-old*old, 0)
+	e.far[e.pos] = sample
+	e.far[e.pos+e.taps] = sample
+	e.pos = (e.pos + 1) % e.taps
+	return e.far[e.pos : e.pos+e.taps]
+}
+
+// farEnd hands what the player plays to an echo canceller as it reads
+// it.
+type farEnd struct {
+	r    io.Reader
+	echo *EchoCanceller
+}
+
+func (f *farEnd) Read(b []byte) (int, error) {
+	n, err := f.r.Read(b)
+	if f.echo != nil && n > 0 {
+		f.echo.Far(pcmToFloat32(b[:n]))
+	}
+	return n, err
+}
+
+func pcmToFloat32(pcm []byte) []float32 {
+	samples := make([]float32, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / math.MaxInt16
+	}
+	return samples
+}
@@ -0,0 +1,120 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// room returns the impulse response of a speaker reaching a microphone:
+// the direct path after delay samples and reflections fading after it.
+func room(delay int, gain float64, r *rand.Rand) []float64 {
+	h := make([]float64, delay+400)
+	h[delay] = gain
+	for k := delay + 1; k < len(h); k++ {
+		h[k] = gain * 0.1 * (2*r.Float64() - 1) * math.Exp(-float64(k-delay)/80)
+	}
+	return h
+}
+
+// convolve returns x through h.
+func convolve(x []float32, h []float64) []float32 {
+	y := make([]float32, len(x))
+	for n := range y {
+		var sum float64
+		for k := 0; k < len(h) && k <= n; k++ {
+			sum += h[k] * float64(x[n-k])
+		}
+		y[n] = float32(sum)
+	}
+	return y
+}
+
+// voice returns d of noise shaped a little like speech, loud and quiet
+// in turn.
+func voice(d time.Duration, r *rand.Rand) []float32 {
+	samples := make([]float32, int(d.Seconds()*sampleRate))
+	var low float64
+	for i := range samples {
+		low += (0.3*(2*r.Float64()-1) - low) * 0.3
+		envelope := 0.6 + 0.4*math.Sin(2*math.Pi*3*float64(i)/sampleRate)
+		samples[i] = float32(low * envelope)
+	}
+	return samples
+}
+
+// cancel runs near through e a packet at a time, feeding it far as it
+// goes, and returns what is left.
+func cancel(e *EchoCanceller, far, near []float32) []float32 {
+	out := make([]float32, len(near))
+	copy(out, near)
+	for i := 0; i < len(out); i += framesPerBuffer {
+		end := min(i+framesPerBuffer, len(out))
+		e.Far(far[i:end])
+		e.Process(out[i:end])
+	}
+	return out
+}
+
+// erle returns the echo return loss enhancement over the last d: how
+// much quieter the echo is after cancelling than before, in dB.
+func erle(echo, residual []float32, d time.Duration) float64 {
+	return level(tail(echo, d)) - level(tail(residual, d))
+}
+
+func TestEchoCanceller(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	t.Run("cancels echo", func(t *testing.T) {
+		for _, delay := range []int{0, 500, 1500} {
+			far := voice(4*time.Second, r)
+			echo := convolve(far, room(delay, 0.5, r))
+			residual := cancel(NewEchoCanceller(), far, echo)
+			got := erle(echo, residual, time.Second)
+			t.Logf("delay %d: ERLE %.1fdB", delay, got)
+			if got < 20 {
+				t.Errorf("delay %d: expected an ERLE of at least 20dB, got %.1fdB", delay, got)
+			}
+		}
+	})
+
+	t.Run("keeps the near end", func(t *testing.T) {
+		far := voice(4*time.Second, r)
+		echo := convolve(far, room(300, 0.5, r))
+		near := sine(440, 0.2, 4*time.Second)
+		// the near end only starts talking once the filter has converged
+		mixed := make([]float32, len(echo))
+		start := 3 * sampleRate
+		for i := range mixed {
+			mixed[i] = echo[i]
+			if i >= start {
+				mixed[i] += near[i]
+			}
+		}
+
+		residual := cancel(NewEchoCanceller(), far, mixed)
+		diff := make([]float32, len(residual))
+		for i := range diff {
+			if i >= start {
+				diff[i] = residual[i] - near[i]
+			}
+		}
+		// what is left over the near end is the echo, well below it
+		if got := level(tail(near, 500*time.Millisecond)) - level(tail(diff, 500*time.Millisecond)); got < 15 {
+			t.Errorf("expected the near end %.1fdB above what is left of the echo, at least 15dB", got)
+		}
+	})
+
+	t.Run("no far end", func(t *testing.T) {
+		near := sine(440, 0.2, time.Second)
+		out := make([]float32, len(near))
+		copy(out, near)
+		process(NewEchoCanceller(), out)
+		for i := range out {
+			if out[i] != near[i] {
+				t.Fatalf("sample %d\nExpected: %f\nGot: %f", i, near[i], out[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// packetSamples is how much audio a packet holds, and so how much a
+	// lost one is made up for with
+	packetSamples = framesPerBuffer
+	// minDepth and maxDepth bound the packets held before playing, the
+	// depth between them following the jitter of the arrivals
+	minDepth = 2
+	maxDepth = 25
+	// maxHeld caps the packets held, the ones further ahead being taken
+	// as the sender starting over
+	maxHeld = 64
+	// historySamples is how much of what was played is kept to find the
+	// pitch to conceal a loss with
+	historySamples = 640
+	// minPitch and maxPitch are the shortest and longest pitch periods
+	// looked for, 400Hz and 50Hz
+	minPitch = 40
+	maxPitch = 320
+	// pitchWindow is how many samples are compared to find the pitch
+	pitchWindow = 160
+	// fadeSamples is how long concealment takes to fade to silence
+	fadeSamples = 960
+)
+
+// JitterStats counts what a JitterBuffer played and threw away.
+type JitterStats struct {
+	// Played packets arrived in time
+	Played int
+	// Concealed packets were made up for lost or late ones
+	Concealed int
+	// Late packets arrived after their turn had passed
+	Late int
+	// Dropped packets were skipped to catch up with a buffer grown too
+	// deep
+	Dropped int
+}
+
+// JitterBuffer holds the audio packets of one sender, playing them in
+// order once enough are held to ride out the jitter of their arrivals.
+// Lost packets are concealed by repeating the last pitch period heard,
+// fading out.
+type JitterBuffer struct {
+	mu      sync.Mutex
+	packets map[uint16]Packet
+	// next is the sequence number to play next, once started
+	next    uint16
+	started bool
+	// playing is false until enough packets are held
+	playing bool
+	// jitter is the mean deviation of the arrivals from the pace they
+	// were captured at, in samples, and transit the last arrival time
+	// less its timestamp
+	jitter  float64
+	transit float64
+	timed   bool
+	// pending is what is left of the packet being read
+	pending []byte
+	// captured is the capture time of the last packet played, heard at
+	// heard, and fresh until heard is set
+	captured uint64
+	heard    time.Time
+	fresh    bool
+	history  []int16
+	// concealed counts the samples made up since the last packet
+	// played, repeating period
+	concealed int
+	period    int
+	// comfort is the amplitude of the noise to play in place of silence,
+	// zero when speech was played last
+	comfort float64
+	// speaking is set while packets of speech are played
+	speaking bool
+	stats    JitterStats
+}
+
+func NewJitterBuffer() *JitterBuffer {
+	return &JitterBuffer{packets: make(map[uint16]Packet)}
+}
+
+// Stats returns the counts since the buffer was made.
+func (j *JitterBuffer) Stats() JitterStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+// Push adds a packet that arrived at now.
+func (j *JitterBuffer) Push(p Packet, now time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	transit := float64(now.UnixNano())*sampleRate/1e9 - float64(p.Timestamp)
+	if j.timed {
+		j.jitter += (math.Abs(transit-j.transit) - j.jitter) / 16
+	}
+	j.transit, j.timed = transit, true
+
+	// until playing starts the first packet may still be overtaken
+	if !j.started && (len(j.packets) == 0 || int16(p.Seq-j.next) < 0) {
+		j.next = p.Seq
+	}
+	ahead := int16(p.Seq - j.next)
+	if ahead < 0 {
+		j.stats.Late++
+		return
+	}
+	if ahead >= maxHeld {
+		clear(j.packets)
+		j.next, j.playing = p.Seq, false
+	}
+	if _, ok := j.packets[p.Seq]; ok {
+		return
+	}
+	j.packets[p.Seq] = p
+}
+
+// Playing returns when the audio captured at captured is heard, false
+// until a packet has been played.
+func (j *JitterBuffer) Playing() (captured uint64, at time.Time, ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.captured, j.heard, !j.heard.IsZero()
+}
+
+// Speaking reports whether speech is being played rather than silence,
+// comfort noise or concealment of an empty buffer.
+func (j *JitterBuffer) Speaking() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.speaking
+}
+
+// depth is how many packets to hold before playing.
+func (j *JitterBuffer) depth() int {
+	return min(minDepth+int(math.Ceil(3*j.jitter/packetSamples)), maxDepth)
+}
+
+// Read fills b with what is to be played next, never blocking: when no
+// packet is there to be played, b is filled with concealment.
+func (j *JitterBuffer) Read(b []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for n < len(b) {
+		if len(j.pending) == 0 {
+			j.pending = j.pull()
+			if j.fresh {
+				// behind what the output buffer holds and what came
+				// before it in b
+				j.heard = now.Add(outputLatency + time.Duration(n/2)*time.Second/sampleRate)
+				j.fresh = false
+			}
+		}
+		c := copy(b[n:], j.pending)
+		j.pending = j.pending[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// pull returns the next packet to play.
+func (j *JitterBuffer) pull() []byte {
+	depth := j.depth()
+	if !j.playing {
+		if len(j.packets) < depth {
+			return j.conceal()
+		}
+		j.playing, j.started = true, true
+	}
+
+	// the buffer grows when the sender's clock runs faster than ours or
+	// after a burst, so skip a packet to bring the delay back down
+	if len(j.packets) > 2*depth+minDepth {
+		if _, ok := j.packets[j.next]; ok {
+			delete(j.packets, j.next)
+			j.stats.Dropped++
+		}
+		j.next++
+	}
+
+	p, ok := j.packets[j.next]
+	if !ok {
+		if len(j.packets) == 0 {
+			// nothing to play, so wait for the buffer to fill again in
+			// case the next packet is only late
+			j.playing, j.speaking = false, false
+			return j.conceal()
+		}
+		j.next++
+		return j.conceal()
+	}
+
+	delete(j.packets, j.next)
+	j.next++
+	if p.Codec == ComfortNoise {
+		// uniform noise of amplitude a has an rms of a/√3
+		j.comfort = math.Sqrt(3) * 32768 * math.Pow(10, -float64(p.Level)/20)
+		j.speaking = false
+		return j.conceal()
+	}
+	j.stats.Played++
+	j.concealed, j.comfort, j.speaking = 0, 0, true
+	j.captured, j.fresh = p.Captured, true
+	pcm := p.PCM
+	for i := 0; i+1 < len(pcm); i += 2 {
+		j.history = append(j.history, int16(binary.LittleEndian.Uint16(pcm[i:])))
+	}
+	if len(j.history) > historySamples {
+		j.history = j.history[len(j.history)-historySamples:]
+	}
+	return pcm
+}
+
+// conceal makes up a packet by repeating the last pitch period played,
+// fading out over fadeSamples, or of comfort noise once told to.
+func (j *JitterBuffer) conceal() []byte {
+	out := make([]byte, 2*packetSamples)
+	if j.comfort > 0 {
+		for i := range packetSamples {
+			s := (2*rand.Float64() - 1) * j.comfort
+			binary.LittleEndian.PutUint16(out[2*i:], uint16(int16(s)))
+		}
+		return out
+	}
+	if j.concealed >= fadeSamples || len(j.history) == 0 {
+		return out
+	}
+	if j.concealed == 0 {
+		j.period = pitchPeriod(j.history)
+	}
+	j.stats.Concealed++
+
+	start := len(j.history) - j.period
+	for i := 0; i < packetSamples && j.concealed < fadeSamples; i++ {
+		gain := 1 - float64(j.concealed)/fadeSamples
+		s := float64(j.history[start+j.concealed%j.period]) * gain
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(int16(s)))
+		j.concealed++
+	}
+	return out
+}
+
+// pitchPeriod returns the lag at which the end of history best matches
+// what came before it, or all of a history too short to search.
+func pitchPeriod(history []int16) int {
+	maxLag := min(maxPitch, len(history)-pitchWindow)
+	if maxLag < minPitch {
+		return len(history)
+	}
+
+	tail := history[len(history)-pitchWindow:]
+	best, bestScore := maxLag, 0.0
+	for lag := minPitch; lag <= maxLag; lag++ {
+		past := history[len(history)-pitchWindow-lag : len(history)-lag]
+		var xy, yy float64
+		for i := range tail {
+			xy += float64(tail[i]) * float64(past[i])
+			yy += float64(past[i]) * float64(past[i])
+		}
+		if yy == 0 {
+			continue
+		}
+		if score := xy / math.Sqrt(yy); score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,207 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// tone returns packet seq of a 200Hz tone, 80 samples a period.
+func tone(seq int) Packet {
+	pcm := make([]byte, 2*packetSamples)
+	for i := range packetSamples {
+		n := seq*packetSamples + i
+		s := int16(8000 * math.Sin(2*math.Pi*float64(n)/80))
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(s))
+	}
+	return Packet{Seq: uint16(seq), Timestamp: uint32(seq * packetSamples), PCM: pcm}
+}
+
+// arrival is when packet seq would arrive with no jitter.
+func arrival(seq int) time.Time {
+	return time.Unix(1000, 0).Add(time.Duration(seq*packetSamples) * time.Second / sampleRate)
+}
+
+// play reads n packets from j.
+func play(j *JitterBuffer, n int) [][]byte {
+	var played [][]byte
+	for range n {
+		b := make([]byte, 2*packetSamples)
+		j.Read(b)
+		played = append(played, b)
+	}
+	return played
+}
+
+func silent(pcm []byte) bool {
+	for _, b := range pcm {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestJitterBuffer(t *testing.T) {
+	t.Run("waits for the depth", func(t *testing.T) {
+		j := NewJitterBuffer()
+		j.Push(tone(0), arrival(0))
+		if played := play(j, 1); !silent(played[0]) {
+			t.Errorf("expected silence before %d packets are held", minDepth)
+		}
+		j.Push(tone(1), arrival(1))
+		played := play(j, 2)
+		if !reflect.DeepEqual(played, [][]byte{tone(0).PCM, tone(1).PCM}) {
+			t.Errorf("expected packets 0 and 1 to play")
+		}
+	})
+
+	t.Run("in order", func(t *testing.T) {
+		j := NewJitterBuffer()
+		for _, seq := range []int{1, 0, 3, 2} {
+			j.Push(tone(seq), arrival(3))
+		}
+		played := play(j, 4)
+		for seq, pcm := range played {
+			if !reflect.DeepEqual(pcm, tone(seq).PCM) {
+				t.Errorf("expected packet %d to play in turn", seq)
+			}
+		}
+		if stats := j.Stats(); stats.Played != 4 || stats.Concealed != 0 {
+			t.Errorf("expected 4 played, got %+v", stats)
+		}
+	})
+
+	t.Run("playing", func(t *testing.T) {
+		j := NewJitterBuffer()
+		if _, _, ok := j.Playing(); ok {
+			t.Errorf("expected nothing playing yet")
+		}
+		for seq := range 3 {
+			p := tone(seq)
+			p.Captured = uint64(1000 + 10*seq)
+			j.Push(p, arrival(seq))
+		}
+		before := time.Now()
+		// packet 1 starts halfway into b
+		j.Read(make([]byte, 4*packetSamples))
+		captured, at, ok := j.Playing()
+		if !ok || captured != 1010 {
+			t.Fatalf("expected packet 1 playing, got %d %v", captured, ok)
+		}
+		early := before.Add(outputLatency + packetSamples*time.Second/sampleRate)
+		if at.Before(early) || at.After(time.Now().Add(outputLatency+packetSamples*time.Second/sampleRate)) {
+			t.Errorf("expected packet 1 heard a packet after the output latency, got %s after reading", at.Sub(before))
+		}
+	})
+
+	t.Run("late", func(t *testing.T) {
+		j := NewJitterBuffer()
+		for _, seq := range []int{0, 2, 3} {
+			j.Push(tone(seq), arrival(seq))
+		}
+		play(j, 2)
+		j.Push(tone(1), arrival(4))
+		if stats := j.Stats(); stats.Late != 1 || stats.Concealed != 1 {
+			t.Errorf("expected 1 late and 1 concealed packet, got %+v", stats)
+		}
+		if played := play(j, 1); !reflect.DeepEqual(played[0], tone(2).PCM) {
+			t.Errorf("expected packet 2 after the late one")
+		}
+	})
+
+	t.Run("conceals a loss", func(t *testing.T) {
+		j := NewJitterBuffer()
+		for seq := range 10 {
+			if seq != 6 {
+				j.Push(tone(seq), arrival(seq))
+			}
+		}
+		played := play(j, 10)
+
+		// the tone carries on, fading, until packet 7 arrives
+		var xy, xx, yy float64
+		want := tone(6).PCM
+		for i := 0; i < len(want); i += 2 {
+			x := float64(int16(binary.LittleEndian.Uint16(want[i:])))
+			y := float64(int16(binary.LittleEndian.Uint16(played[6][i:])))
+			xy, xx, yy = xy+x*y, xx+x*x, yy+y*y
+		}
+		if corr := xy / math.Sqrt(xx*yy); corr < 0.99 {
+			t.Errorf("expected the concealment to follow the tone, correlation %f", corr)
+		}
+		if !reflect.DeepEqual(played[7], tone(7).PCM) {
+			t.Errorf("expected packet 7 after the concealment")
+		}
+	})
+
+	t.Run("fades to silence", func(t *testing.T) {
+		j := NewJitterBuffer()
+		for seq := range 4 {
+			j.Push(tone(seq), arrival(seq))
+		}
+		played := play(j, 4+fadeSamples/packetSamples+1)
+		if silent(played[4]) {
+			t.Errorf("expected the first lost packet concealed")
+		}
+		if last := played[len(played)-1]; !silent(last) {
+			t.Errorf("expected silence once the concealment faded")
+		}
+	})
+
+	t.Run("deepens with jitter", func(t *testing.T) {
+		j := NewJitterBuffer()
+		for seq := range 50 {
+			// every other packet 20ms late
+			at := arrival(seq)
+			if seq%2 == 1 {
+				at = at.Add(20 * time.Millisecond)
+			}
+			j.Push(tone(seq), at)
+		}
+		if depth := j.depth(); depth <= minDepth {
+			t.Errorf("expected a depth above %d, got %d", minDepth, depth)
+		}
+
+		steady := NewJitterBuffer()
+		for seq := range 50 {
+			steady.Push(tone(seq), arrival(seq))
+		}
+		if depth := steady.depth(); depth != minDepth {
+			t.Errorf("expected depth %d, got %d", minDepth, depth)
+		}
+	})
+}
+
+func TestPitchPeriod(t *testing.T) {
+	history := make([]int16, historySamples)
+	for i := range history {
+		history[i] = int16(8000 * math.Sin(2*math.Pi*float64(i)/100))
+	}
+	if period := pitchPeriod(history); period != 100 && period != 200 && period != 300 {
+		t.Errorf("expected a multiple of 100, got %d", period)
+	}
+}
+
+func TestMixer(t *testing.T) {
+	m := NewMixer()
+	for seq := range 2 {
+		m.Push(1, tone(seq), arrival(seq))
+		m.Push(2, tone(seq), arrival(seq))
+	}
+	b := make([]byte, 2*packetSamples)
+	m.Read(b)
+	for i := 0; i < len(b); i += 2 {
+		want := 2 * int16(binary.LittleEndian.Uint16(tone(0).PCM[i:]))
+		if got := int16(binary.LittleEndian.Uint16(b[i:])); got != want {
+			t.Fatalf("sample %d\nExpected: %d\nGot: %d", i/2, want, got)
+		}
+	}
+
+	m.Remove(2)
+	if _, ok := m.Stats(2); ok {
+		t.Errorf("expected sender 2 gone")
+	}
+}
@@ -0,0 +1,98 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// Mixer plays the audio of several senders at once, each through its own
+// jitter buffer.
+type Mixer struct {
+	mu      sync.Mutex
+	buffers map[uint32]*JitterBuffer
+	sum     []int32
+	scratch []byte
+}
+
+func NewMixer() *Mixer {
+	return &Mixer{buffers: make(map[uint32]*JitterBuffer)}
+}
+
+// Push adds a packet from sender that arrived at now.
+func (m *Mixer) Push(sender uint32, p Packet, now time.Time) {
+	m.mu.Lock()
+	j, ok := m.buffers[sender]
+	if !ok {
+		j = NewJitterBuffer()
+		m.buffers[sender] = j
+	}
+	m.mu.Unlock()
+	j.Push(p, now)
+}
+
+// Remove forgets sender and what it had yet to play.
+func (m *Mixer) Remove(sender uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buffers, sender)
+}
+
+// Stats returns the counts of the jitter buffer of sender.
+func (m *Mixer) Stats(sender uint32) (JitterStats, bool) {
+	m.mu.Lock()
+	j, ok := m.buffers[sender]
+	m.mu.Unlock()
+	if !ok {
+		return JitterStats{}, false
+	}
+	return j.Stats(), true
+}
+
+// Playing returns when the audio of sender captured at captured is
+// heard, false when none of it has been played yet.
+func (m *Mixer) Playing(sender uint32) (captured uint64, at time.Time, ok bool) {
+	m.mu.Lock()
+	j, ok := m.buffers[sender]
+	m.mu.Unlock()
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	return j.Playing()
+}
+
+// Speaking reports whether sender is sending speech rather than
+// silence.
+func (m *Mixer) Speaking(sender uint32) bool {
+	m.mu.Lock()
+	j, ok := m.buffers[sender]
+	m.mu.Unlock()
+	return ok && j.Speaking()
+}
+
+// Read fills b with the sum of what every sender plays next, silence
+// when there are none.
+func (m *Mixer) Read(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(b) &^ 1
+	if cap(m.sum) < n/2 {
+		m.sum = make([]int32, n/2)
+		m.scratch = make([]byte, n)
+	}
+	sum, scratch := m.sum[:n/2], m.scratch[:n]
+	clear(sum)
+	for _, j := range m.buffers {
+		j.Read(scratch)
+		for i := range sum {
+			sum[i] += int32(int16(binary.LittleEndian.Uint16(scratch[2*i:])))
+		}
+	}
+	for i, s := range sum {
+		s = min(max(s, math.MinInt16), math.MaxInt16)
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(int16(s)))
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Packet is one buffer of captured audio: 16 bit little endian PCM
+// samples, the Seq-th buffer its sender captured, Timestamp samples
+// after the first. Captured is when its first sample was captured, in
+// Unix milliseconds like the timestamps of video frames, to play the two
+// in sync. The samples are sent compressed with Codec, or left out
+// for comfort noise of Level, in -dBov.
+type Packet struct {
+	Seq       uint16
+	Timestamp uint32
+	Captured  uint64
+	Codec     Codec
+	PCM       []byte
+	Level     uint8
+}
+
+// Encode lays the packet out as [seq uint16][timestamp uint32]
+// [captured uint64][codec][pcm compressed with codec], comfort noise
+// carrying [level] in place of the samples.
+func (p Packet) Encode() []byte {
+	codec := p.Codec
+	var data []byte
+	if codec == ComfortNoise {
+		data = []byte{p.Level}
+	} else {
+		if _, ok := codecs[codec]; !ok {
+			codec = PCM
+		}
+		data = codec.Encode(p.PCM)
+	}
+	buf := make([]byte, 0, 15+len(data))
+	buf = binary.LittleEndian.AppendUint16(buf, p.Seq)
+	buf = binary.LittleEndian.AppendUint32(buf, p.Timestamp)
+	buf = binary.LittleEndian.AppendUint64(buf, p.Captured)
+	buf = append(buf, byte(codec))
+	return append(buf, data...)
+}
+
+func (p *Packet) Decode(bs []byte) error {
+	if len(bs) < 15 {
+		return errors.New("audio packet too small")
+	}
+	codec := Codec(bs[14])
+	var pcm []byte
+	var level uint8
+	if codec == ComfortNoise {
+		if len(bs) < 16 {
+			return errors.New("comfort noise level missing")
+		}
+		level = bs[15]
+	} else {
+		var err error
+		pcm, err = codec.Decode(bs[15:])
+		if err != nil {
+			return err
+		}
+	}
+
+	p.Seq = binary.LittleEndian.Uint16(bs[:2])
+	p.Timestamp = binary.LittleEndian.Uint32(bs[2:6])
+	p.Captured = binary.LittleEndian.Uint64(bs[6:14])
+	p.Codec = codec
+	p.PCM = pcm
+	p.Level = level
+
+	return nil
+}
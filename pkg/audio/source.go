@@ -0,0 +1,176 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// toneFrequency and toneAmplitude are those of the tone source when
+	// no frequency is given
+	toneFrequency = 440.0
+	toneAmplitude = 0.25
+)
+
+// Source captures the audio a bro sends. Read fills samples, blocking
+// until they have been captured, and returns io.EOF once the source is
+// exhausted.
+type Source interface {
+	Read(samples []float32) error
+	Close() error
+}
+
+// Sink plays the audio a bro hears. Play starts reading 16-bit PCM from r
+// as fast as it is played, which r must never block for.
+type Sink interface {
+	Play(r io.Reader)
+	Close() error
+}
+
+// OpenSource opens the audio source described by spec:
+//
+//	mic        the default microphone
+//	tone       a 440Hz tone
+//	tone:HZ    a tone of HZ
+//	FILE.wav   a 16-bit PCM WAV file, played once
+//
+// The microphone needs a build with PortAudio, which is left out with
+// CGO_ENABLED=0 or -tags noportaudio.
+func OpenSource(spec string) (Source, error) {
+	switch {
+	case spec == "" || spec == "mic":
+		return newMicSource()
+	case spec == "tone":
+		return newToneSource(toneFrequency), nil
+	case strings.HasPrefix(spec, "tone:"):
+		freq, err := strconv.ParseFloat(strings.TrimPrefix(spec, "tone:"), 64)
+		if err != nil || freq <= 0 || freq >= sampleRate/2 {
+			return nil, fmt.Errorf("bad tone %q", spec)
+		}
+		return newToneSource(freq), nil
+	case strings.HasSuffix(spec, ".wav"):
+		return newWAVSource(spec)
+	}
+	return nil, fmt.Errorf("unknown audio source %q", spec)
+}
+
+// OpenSink opens the audio sink described by spec:
+//
+//	speaker    the default speakers
+//	null       nowhere, for running without sound
+//	FILE.wav   a 16-bit PCM WAV file recording what is heard
+//
+// The speakers need a build with oto, which is left out with
+// CGO_ENABLED=0 or -tags noportaudio.
+func OpenSink(spec string) (Sink, error) {
+	switch {
+	case spec == "" || spec == "speaker":
+		return newSpeakerSink()
+	case spec == "null":
+		return newPacedSink(io.Discard), nil
+	case strings.HasSuffix(spec, ".wav"):
+		return newWAVSink(spec)
+	}
+	return nil, fmt.Errorf("unknown audio sink %q", spec)
+}
+
+// pacer keeps a source or sink going at the pace audio is played.
+type pacer struct {
+	next time.Time
+}
+
+// wait blocks until samples more samples are due after the last.
+func (p *pacer) wait(samples int) {
+	if p.next.IsZero() {
+		p.next = time.Now()
+	}
+	p.next = p.next.Add(time.Duration(samples) * time.Second / sampleRate)
+	time.Sleep(time.Until(p.next))
+}
+
+// toneSource is a sine wave, for a bro without a microphone to still send
+// something to hear.
+type toneSource struct {
+	step  float64
+	phase float64
+	pace  pacer
+}
+
+func newToneSource(freq float64) *toneSource {
+	return &toneSource{step: 2 * math.Pi * freq / sampleRate}
+}
+
+func (s *toneSource) Read(samples []float32) error {
+	s.pace.wait(len(samples))
+	for i := range samples {
+		samples[i] = float32(toneAmplitude * math.Sin(s.phase))
+		s.phase = math.Mod(s.phase+s.step, 2*math.Pi)
+	}
+	return nil
+}
+
+func (s *toneSource) Close() error {
+	return nil
+}
+
+// pacedSink reads a packet at a time at the pace audio is played and
+// writes it to w, the way speakers would play it.
+type pacedSink struct {
+	w       io.Writer
+	playing bool
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+func newPacedSink(w io.Writer) *pacedSink {
+	return &pacedSink{
+		w:    w,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (s *pacedSink) Play(r io.Reader) {
+	s.playing = true
+	go func() {
+		defer close(s.done)
+		var pace pacer
+		b := make([]byte, 2*packetSamples)
+		for {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			pace.wait(packetSamples)
+			n, err := io.ReadFull(r, b)
+			if _, werr := s.w.Write(b[:n]); werr != nil {
+				s.err = werr
+				return
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					s.err = err
+				}
+				return
+			}
+		}
+	}()
+}
+
+// Close stops playing, returning once nothing more is written.
+func (s *pacedSink) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	if s.playing {
+		<-s.done
+	}
+	return s.err
+}
@@ -0,0 +1,293 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readAll reads source a packet at a time until it runs out.
+func readAll(t *testing.T, source Source) []float32 {
+	var samples []float32
+	for {
+		buffer := make([]float32, framesPerBuffer)
+		err := source.Read(buffer)
+		if errors.Is(err, io.EOF) {
+			return samples
+		}
+		if err != nil {
+			t.Fatalf("error reading: %v", err)
+		}
+		samples = append(samples, buffer...)
+	}
+}
+
+// crossings counts how often samples cross zero.
+func crossings(samples []float32) int {
+	var n int
+	for i := 1; i < len(samples); i++ {
+		if (samples[i] < 0) != (samples[i-1] < 0) {
+			n++
+		}
+	}
+	return n
+}
+
+// writeWAV writes a 16-bit WAV file of rate and channels, its samples
+// interleaved.
+func writeWAV(t *testing.T, path string, rate, channels int, samples []int16) {
+	data := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+	}
+	header := wavHeader(uint32(len(data)))
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(rate*channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(channels*2))
+	if err := os.WriteFile(path, append(header, data...), 0o644); err != nil {
+		t.Fatalf("error writing %s: %v", path, err)
+	}
+}
+
+func TestOpenSource(t *testing.T) {
+	for _, spec := range []string{"tone:x", "tone:0", "tone:8000", "microphone", "missing.wav"} {
+		if _, err := OpenSource(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+	for _, spec := range []string{"speakers", "out.mp3"} {
+		if _, err := OpenSink(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestToneSource(t *testing.T) {
+	source, err := OpenSource("tone:1000")
+	if err != nil {
+		t.Fatalf("error opening tone source: %v", err)
+	}
+	defer source.Close()
+
+	start := time.Now()
+	samples := make([]float32, sampleRate/4)
+	for i := 0; i < len(samples); i += framesPerBuffer {
+		source.Read(samples[i:min(i+framesPerBuffer, len(samples))])
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected a quarter of a second of tone to take as long, took %v", elapsed)
+	}
+	if got := level(samples); math.Abs(got-sineLevel(toneAmplitude)) > 0.1 {
+		t.Errorf("Expected: %.1fdBFS\nGot: %.1fdBFS", sineLevel(toneAmplitude), got)
+	}
+	// a 1000Hz sine crosses zero 2000 times a second
+	if got := crossings(samples); got < 498 || got > 502 {
+		t.Errorf("Expected: 500 crossings\nGot: %d", got)
+	}
+}
+
+func TestWAV(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("round trip", func(t *testing.T) {
+		path := filepath.Join(dir, "round.wav")
+		pcm := float32ToPCM(sine(440, 0.5, 250*time.Millisecond))
+
+		sink, err := OpenSink(path)
+		if err != nil {
+			t.Fatalf("error opening WAV sink: %v", err)
+		}
+		sink.Play(bytes.NewReader(pcm))
+		<-sink.(*wavSink).done
+		if err := sink.Close(); err != nil {
+			t.Fatalf("error closing WAV sink: %v", err)
+		}
+
+		file, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("error reading %s: %v", path, err)
+		}
+		if !bytes.Equal(file[:wavHeaderSize], wavHeader(uint32(len(pcm)))) {
+			t.Errorf("Expected: %v\nGot: %v", wavHeader(uint32(len(pcm))), file[:wavHeaderSize])
+		}
+
+		source, err := OpenSource(path)
+		if err != nil {
+			t.Fatalf("error opening WAV source: %v", err)
+		}
+		defer source.Close()
+		samples := readAll(t, source)
+		// the last packet is padded with silence
+		if want := (len(pcm)/2 + framesPerBuffer - 1) / framesPerBuffer * framesPerBuffer; len(samples) != want {
+			t.Fatalf("Expected: %d samples\nGot: %d", want, len(samples))
+		}
+		for i, s := range samples {
+			var want int16
+			if i < len(pcm)/2 {
+				want = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+			}
+			if got := int16(math.Round(float64(s) * math.MaxInt16)); got != want {
+				t.Fatalf("sample %d\nExpected: %d\nGot: %d", i, want, got)
+			}
+		}
+	})
+
+	t.Run("mixes and resamples", func(t *testing.T) {
+		path := filepath.Join(dir, "stereo.wav")
+		// a 500Hz sine on the left of a 32kHz file, nothing on the right
+		samples := make([]int16, 2*32000/4)
+		for i := 0; i < len(samples); i += 2 {
+			samples[i] = int16(0.5 * math.MaxInt16 * math.Sin(2*math.Pi*500*float64(i/2)/32000))
+		}
+		writeWAV(t, path, 32000, 2, samples)
+
+		source, err := OpenSource(path)
+		if err != nil {
+			t.Fatalf("error opening WAV source: %v", err)
+		}
+		defer source.Close()
+		got := readAll(t, source)[:sampleRate/4]
+		if l := level(got); math.Abs(l-sineLevel(0.25)) > 0.1 {
+			t.Errorf("Expected: %.1fdBFS\nGot: %.1fdBFS", sineLevel(0.25), l)
+		}
+		if n := crossings(got); n < 248 || n > 252 {
+			t.Errorf("Expected: 250 crossings\nGot: %d", n)
+		}
+	})
+
+	t.Run("not a WAV file", func(t *testing.T) {
+		path := filepath.Join(dir, "text.wav")
+		os.WriteFile(path, []byte("not a WAV file at all, just some text"), 0o644)
+		if _, err := OpenSource(path); !errors.Is(err, errNotWAV) {
+			t.Errorf("Expected: %v\nGot: %v", errNotWAV, err)
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		path := filepath.Join(dir, "8bit.wav")
+		writeWAV(t, path, sampleRate, 1, make([]int16, 100))
+		file, _ := os.ReadFile(path)
+		binary.LittleEndian.PutUint16(file[34:], 8)
+		os.WriteFile(path, file, 0o644)
+		if _, err := OpenSource(path); !errors.Is(err, errWAVFormat) {
+			t.Errorf("Expected: %v\nGot: %v", errWAVFormat, err)
+		}
+	})
+}
+
+// countingReader is endless silence, counting how much of it is read.
+type countingReader struct {
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	clear(b)
+	r.n.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func TestNullSink(t *testing.T) {
+	sink, err := OpenSink("null")
+	if err != nil {
+		t.Fatalf("error opening null sink: %v", err)
+	}
+	r := &countingReader{}
+	sink.Play(r)
+	time.Sleep(250 * time.Millisecond)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("error closing null sink: %v", err)
+	}
+
+	// it reads at the pace audio plays, 2 bytes a sample
+	read := r.n.Load()
+	if want := int64(sampleRate / 2); read < want*3/4 || read > want*5/4 {
+		t.Errorf("Expected: about %d bytes read\nGot: %d", want, read)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if r.n.Load() != read {
+		t.Errorf("expected nothing read once closed")
+	}
+}
+
+func TestAudioPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heard.wav")
+
+	source, err := OpenSource("tone:1000")
+	if err != nil {
+		t.Fatalf("error opening tone source: %v", err)
+	}
+	audio := NewAudio(source)
+	defer audio.Close()
+
+	sink, err := OpenSink(path)
+	if err != nil {
+		t.Fatalf("error opening WAV sink: %v", err)
+	}
+	player := NewPlayer(sink)
+
+	go audio.Start()
+	player.Start()
+	done := time.After(time.Second)
+loop:
+	for {
+		select {
+		case packet := <-audio.Output:
+			player.Input <- packet
+		case <-done:
+			break loop
+		}
+	}
+	if err := player.Close(); err != nil {
+		t.Fatalf("error closing player: %v", err)
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", path, err)
+	}
+	heard := pcmToFloat32(file[wavHeaderSize:])
+	if len(heard) < sampleRate/2 {
+		t.Fatalf("expected about a second heard, got %d samples", len(heard))
+	}
+	// the tone, after the packets that were heard as silence while the
+	// jitter buffer filled
+	if got := level(tail(heard, 300*time.Millisecond)); math.Abs(got-sineLevel(toneAmplitude)) > 1 {
+		t.Errorf("Expected: %.1fdBFS\nGot: %.1fdBFS", sineLevel(toneAmplitude), got)
+	}
+	stats, _ := player.mixer.Stats(0)
+	if stats.Played == 0 {
+		t.Errorf("expected packets played, got %+v", stats)
+	}
+}
+
+func TestAudioBehind(t *testing.T) {
+	source, err := OpenSource("tone")
+	if err != nil {
+		t.Fatalf("error opening tone source: %v", err)
+	}
+	audio := NewAudio(source)
+	defer audio.Close()
+	go audio.Start()
+
+	// capture keeps going while nothing takes the packets
+	time.Sleep(300 * time.Millisecond)
+	for range outputQueue {
+		<-audio.Output
+	}
+	select {
+	case packet := <-audio.Output:
+		if packet.Seq <= outputQueue {
+			t.Errorf("expected the packets that did not fit dropped, got packet %d next", packet.Seq)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("expected capture to carry on")
+	}
+}
@@ -0,0 +1,138 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	// minFloor is the quietest the noise floor is taken to be, in dBFS
+	minFloor = -90.0
+	// speechMargin is how far above the noise floor speech is, in dB
+	speechMargin = 9.0
+	// floorRise is how fast the noise floor follows louder noise, in dB a
+	// packet, so a fan switching on is not taken for speech for long
+	floorRise = 0.01
+	// hissCrossings is the share of samples crossing zero above which
+	// sound only somewhat louder than the floor is taken for hiss
+	hissCrossings = 0.4
+	// hangover is how long packets are still sent after speech stops,
+	// not to clip the ends of words
+	hangover = 200 * time.Millisecond
+	// comfortInterval is how often comfort noise is sent while silent
+	comfortInterval = 500 * time.Millisecond
+)
+
+// packetsIn is how many packets hold d of audio.
+func packetsIn(d time.Duration) int {
+	return int(d * sampleRate / time.Second / packetSamples)
+}
+
+// VAD tells speech from silence by how far the energy of a packet is
+// above the noise floor, tracking the floor as it goes, and how often
+// its samples cross zero.
+type VAD struct {
+	// floor is the energy of the noise, in dBFS
+	floor float64
+	// hang counts down the packets left of the hangover
+	hang int
+}
+
+func NewVAD() *VAD {
+	return &VAD{floor: -60}
+}
+
+// Detect reports whether pcm holds speech, staying true for the hangover
+// after it.
+func (v *VAD) Detect(pcm []byte) bool {
+	energy, crossings := analyse(pcm)
+
+	speech := energy > v.floor+speechMargin &&
+		(crossings < hissCrossings || energy > v.floor+2*speechMargin)
+	if energy < v.floor {
+		v.floor = energy
+	} else {
+		v.floor = min(v.floor+floorRise, energy)
+	}
+	v.floor = max(v.floor, minFloor)
+
+	if speech {
+		v.hang = packetsIn(hangover)
+		return true
+	}
+	if v.hang > 0 {
+		v.hang--
+		return true
+	}
+	return false
+}
+
+// NoiseLevel returns the noise floor in -dBov, the way comfort noise
+// carries it.
+func (v *VAD) NoiseLevel() uint8 {
+	return uint8(min(max(-v.floor, 0), 127))
+}
+
+// analyse returns the energy of pcm in dBFS and the share of its samples
+// crossing zero.
+func analyse(pcm []byte) (energy, crossings float64) {
+	n := len(pcm) / 2
+	if n == 0 {
+		return minFloor, 0
+	}
+
+	var sum float64
+	var crossed int
+	var last int16
+	for i := range n {
+		s := int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+		sum += float64(s) * float64(s)
+		if i > 0 && (s < 0) != (last < 0) {
+			crossed++
+		}
+		last = s
+	}
+
+	energy = 10 * math.Log10(sum/float64(n)/(32768*32768))
+	return max(energy, minFloor), float64(crossed) / float64(n)
+}
+
+// packetizer numbers captured buffers into packets, leaving out silence
+// for comfort noise when suppressing it.
+type packetizer struct {
+	vad      *VAD
+	suppress bool
+	seq      uint16
+	ts       uint32
+	// silent counts the packets left out since speech stopped
+	silent int
+}
+
+func newPacketizer() *packetizer {
+	return &packetizer{vad: NewVAD()}
+}
+
+// next returns the packet to send for pcm captured at captured, false
+// when there is none to send.
+func (p *packetizer) next(pcm []byte, captured time.Time) (Packet, bool) {
+	packet := Packet{Timestamp: p.ts, Captured: uint64(captured.UnixMilli()), PCM: pcm}
+	p.ts += uint32(len(pcm) / 2)
+
+	speech := p.vad.Detect(pcm)
+	if !p.suppress || speech {
+		p.silent = 0
+	} else {
+		// comfort noise as soon as speech stops and every so often after
+		send := p.silent%packetsIn(comfortInterval) == 0
+		p.silent++
+		if !send {
+			return Packet{}, false
+		}
+		packet.Codec, packet.Level, packet.PCM = ComfortNoise, p.vad.NoiseLevel(), nil
+	}
+
+	packet.Seq = p.seq
+	p.seq++
+	return packet, true
+}
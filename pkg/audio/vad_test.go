@@ -0,0 +1,140 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// noise returns a packet of white noise of amplitude a.
+func noise(a float64) []byte {
+	pcm := make([]byte, 2*packetSamples)
+	for i := range packetSamples {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16((2*rand.Float64()-1)*a)))
+	}
+	return pcm
+}
+
+func TestVAD(t *testing.T) {
+	t.Run("speech over noise", func(t *testing.T) {
+		v := NewVAD()
+		for i := range 100 {
+			if v.Detect(noise(30)) && i > packetsIn(hangover) {
+				t.Fatalf("expected quiet noise to be silence")
+			}
+		}
+		if !v.Detect(tone(0).PCM) {
+			t.Errorf("expected a tone to be speech")
+		}
+	})
+
+	t.Run("hangover", func(t *testing.T) {
+		v := NewVAD()
+		for range 100 {
+			v.Detect(noise(30))
+		}
+		v.Detect(tone(0).PCM)
+		for i := range packetsIn(hangover) {
+			if !v.Detect(noise(30)) {
+				t.Fatalf("expected speech %d packets into the hangover", i)
+			}
+		}
+		if v.Detect(noise(30)) {
+			t.Errorf("expected silence after the hangover")
+		}
+	})
+
+	t.Run("hiss", func(t *testing.T) {
+		v := NewVAD()
+		for range 100 {
+			v.Detect(noise(30))
+		}
+		// louder, but crossing zero at every sample
+		hiss := make([]byte, 2*packetSamples)
+		for i := range packetSamples {
+			binary.LittleEndian.PutUint16(hiss[2*i:], uint16(int16(60*(1-2*(i%2)))))
+		}
+		if energy, _ := analyse(hiss); energy <= v.floor+speechMargin {
+			t.Fatalf("expected hiss louder than the speech margin, got %.1fdB over the floor", energy-v.floor)
+		}
+		if v.Detect(hiss) {
+			t.Errorf("expected hiss to be silence")
+		}
+	})
+
+	t.Run("noise level", func(t *testing.T) {
+		v := NewVAD()
+		for range 100 {
+			v.Detect(make([]byte, 2*packetSamples))
+		}
+		if level := v.NoiseLevel(); level != 90 {
+			t.Errorf("Expected: 90\nGot: %d", level)
+		}
+	})
+}
+
+func TestPacketizer(t *testing.T) {
+	p := newPacketizer()
+	p.suppress = true
+	var sent []Packet
+	silence := packetsIn(hangover) + 2*packetsIn(comfortInterval)
+	for i := range 10 + silence {
+		pcm := tone(i).PCM
+		if i >= 10 {
+			pcm = make([]byte, 2*packetSamples)
+		}
+		if packet, ok := p.next(pcm, time.Now()); ok {
+			sent = append(sent, packet)
+		}
+	}
+
+	// speech and its hangover, then comfort noise every interval
+	want := 10 + packetsIn(hangover) + 2
+	if len(sent) != want {
+		t.Fatalf("expected %d packets, got %d", want, len(sent))
+	}
+	for i, packet := range sent {
+		if packet.Seq != uint16(i) {
+			t.Errorf("expected packet %d numbered %d, got %d", i, i, packet.Seq)
+		}
+		if comfort := packet.Codec == ComfortNoise; comfort != (i >= want-2) {
+			t.Errorf("packet %d: expected comfort noise %v", i, !comfort)
+		}
+	}
+	last := sent[len(sent)-1]
+	if last.Timestamp != uint32((10+silence-packetsIn(comfortInterval))*packetSamples) {
+		t.Errorf("expected the capture timestamp to run on through silence, got %d", last.Timestamp)
+	}
+
+	t.Run("not suppressing", func(t *testing.T) {
+		p := newPacketizer()
+		for range 10 {
+			if packet, ok := p.next(make([]byte, 2*packetSamples), time.Now()); !ok || packet.Codec == ComfortNoise {
+				t.Fatalf("expected every packet sent")
+			}
+		}
+	})
+}
+
+func TestComfortNoise(t *testing.T) {
+	j := NewJitterBuffer()
+	for seq := range 3 {
+		j.Push(tone(seq), arrival(seq))
+	}
+	j.Push(Packet{Seq: 3, Timestamp: 3 * packetSamples, Codec: ComfortNoise, Level: 60}, arrival(3))
+
+	play(j, 3)
+	if !j.Speaking() {
+		t.Errorf("expected speaking while the tone plays")
+	}
+	for _, pcm := range play(j, 10) {
+		energy, _ := analyse(pcm)
+		if energy < -65 || energy > -55 {
+			t.Errorf("expected comfort noise at -60dBFS, got %.1f", energy)
+		}
+	}
+	if j.Speaking() {
+		t.Errorf("expected not speaking after comfort noise")
+	}
+}
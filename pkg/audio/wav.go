@@ -0,0 +1,215 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	wavHeaderSize = 44
+	wavPCM        = 1
+	// wavExtensible is the format of WAV files describing their channels,
+	// which still hold PCM when their bits are 16
+	wavExtensible = 0xfffe
+)
+
+var errNotWAV = errors.New("not a WAV file")
+var errWAVFormat = errors.New("unsupported WAV format, it must be 16-bit PCM")
+
+// wavHeader returns the header of a 16-bit mono WAV file of dataSize
+// bytes of samples at sampleRate.
+func wavHeader(dataSize uint32) []byte {
+	b := make([]byte, wavHeaderSize)
+	copy(b[0:], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], wavHeaderSize-8+dataSize)
+	copy(b[8:], "WAVE")
+	copy(b[12:], "fmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], wavPCM)
+	binary.LittleEndian.PutUint16(b[22:], 1)
+	binary.LittleEndian.PutUint32(b[24:], sampleRate)
+	binary.LittleEndian.PutUint32(b[28:], sampleRate*2)
+	binary.LittleEndian.PutUint16(b[32:], 2)
+	binary.LittleEndian.PutUint16(b[34:], 16)
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], dataSize)
+	return b
+}
+
+// wavSource plays a WAV file at the pace it was recorded, mixing its
+// channels down to one and resampling it to sampleRate.
+type wavSource struct {
+	file     *os.File
+	data     io.Reader
+	channels int
+	// step is how far through the file every sample moves, in its
+	// samples
+	step  float64
+	frame []byte
+	// the sample is frac of the way from a to b
+	a, b float32
+	frac float64
+	// ended is set once b is past the last sample, done once a is
+	ended bool
+	done  bool
+	pace  pacer
+}
+
+func newWAVSource(path string) (Source, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &wavSource{file: file}
+	if err := s.readHeader(bufio.NewReader(file)); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.a, err = s.next()
+	if err != nil {
+		s.done = true
+	}
+	s.b, err = s.next()
+	s.ended = err != nil
+	return s, nil
+}
+
+// readHeader reads the chunks of the file up to its samples.
+func (s *wavSource) readHeader(r io.Reader) error {
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(r, riff); err != nil || string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return errNotWAV
+	}
+
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return errNotWAV
+		}
+		id, size := string(chunk[0:4]), binary.LittleEndian.Uint32(chunk[4:])
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return errNotWAV
+			}
+			format := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return errNotWAV
+			}
+			tag := binary.LittleEndian.Uint16(format[0:])
+			channels := binary.LittleEndian.Uint16(format[2:])
+			rate := binary.LittleEndian.Uint32(format[4:])
+			bits := binary.LittleEndian.Uint16(format[14:])
+			if (tag != wavPCM && tag != wavExtensible) || bits != 16 || channels == 0 || rate == 0 {
+				return errWAVFormat
+			}
+			s.channels = int(channels)
+			s.step = float64(rate) / sampleRate
+		case "data":
+			if s.channels == 0 {
+				return errNotWAV
+			}
+			s.data = io.LimitReader(r, int64(size))
+			s.frame = make([]byte, 2*s.channels)
+			return nil
+		default:
+			// chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, r, int64(size+size%2)); err != nil {
+				return errNotWAV
+			}
+		}
+	}
+}
+
+// next returns the next sample of the file, its channels mixed.
+func (s *wavSource) next() (float32, error) {
+	if _, err := io.ReadFull(s.data, s.frame); err != nil {
+		return 0, io.EOF
+	}
+	var sum float32
+	for c := range s.channels {
+		sum += float32(int16(binary.LittleEndian.Uint16(s.frame[2*c:])))
+	}
+	return sum / float32(s.channels) / math.MaxInt16, nil
+}
+
+// Read fills samples with the next of the file, padding the last with
+// silence.
+func (s *wavSource) Read(samples []float32) error {
+	if s.done {
+		return io.EOF
+	}
+	s.pace.wait(len(samples))
+	for i := range samples {
+		if s.done {
+			samples[i] = 0
+			continue
+		}
+		samples[i] = s.a + (s.b-s.a)*float32(s.frac)
+		for s.frac += s.step; s.frac >= 1; s.frac-- {
+			if s.ended {
+				s.done = true
+				break
+			}
+			var err error
+			s.a = s.b
+			s.b, err = s.next()
+			s.ended = err != nil
+		}
+	}
+	return nil
+}
+
+func (s *wavSource) Close() error {
+	return s.file.Close()
+}
+
+// wavSink records what is heard to a WAV file, at the pace it is played.
+type wavSink struct {
+	*pacedSink
+	file *os.File
+	out  *bufio.Writer
+	size uint32
+}
+
+func newWAVSink(path string) (Sink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	// the sizes are filled in on Close
+	if _, err := file.Write(wavHeader(0)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	s := &wavSink{file: file, out: bufio.NewWriter(file)}
+	s.pacedSink = newPacedSink(s)
+	return s, nil
+}
+
+// Write counts what is written, for the header.
+func (s *wavSink) Write(b []byte) (int, error) {
+	n, err := s.out.Write(b)
+	s.size += uint32(n)
+	return n, err
+}
+
+// Close stops recording and finishes the file.
+func (s *wavSink) Close() error {
+	err := s.pacedSink.Close()
+	if ferr := s.out.Flush(); err == nil {
+		err = ferr
+	}
+	if _, werr := s.file.WriteAt(wavHeader(s.size), 0); err == nil {
+		err = werr
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
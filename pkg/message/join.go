@@ -0,0 +1,84 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Join is the payload of the Info message a bro sends to enter a room.
+// Token is zero on the first join and the server issued resume token
+// when rejoining after losing the connection. Color is the color mode
+// the bro's terminal can show and Codecs has a bit set for every audio
+// codec it can decode, both passed on to the room in the roster.
+type Join struct {
+	Room   string
+	Name   string
+	Token  uint64
+	Color  uint8
+	Codecs uint8
+}
+
+// Encode lays the join out as
+// [room length][room][token uint64][color][codecs][name]. Room and name
+// are cut to 255 bytes, the longest a roster carries.
+func (j Join) Encode() []byte {
+	room := j.Room
+	if len(room) > 255 {
+		room = room[:255]
+	}
+	name := j.Name
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	buf := make([]byte, 0, 1+len(room)+8+2+len(name))
+	buf = append(buf, uint8(len(room)))
+	buf = append(buf, room...)
+	buf = binary.LittleEndian.AppendUint64(buf, j.Token)
+	buf = append(buf, j.Color, j.Codecs)
+	buf = append(buf, name...)
+	return buf
+}
+
+func (j *Join) Decode(bs []byte) error {
+	if len(bs) < 1 {
+		return errors.New("join too small")
+	}
+
+	roomLen := int(bs[0])
+	if len(bs) < 1+roomLen+8+2 {
+		return errors.New("join truncated")
+	}
+
+	bs = bs[1:]
+	j.Room = string(bs[:roomLen])
+	bs = bs[roomLen:]
+	j.Token = binary.LittleEndian.Uint64(bs[:8])
+	j.Color = bs[8]
+	j.Codecs = bs[9]
+	name := bs[10:]
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	j.Name = string(name)
+
+	return nil
+}
+
+func MakeJoin(session uint32, j Join) []byte {
+	return Make(Info, session, j.Encode())
+}
+
+// MakeWelcome is the "ok" Info the server answers a successful Join
+// with, followed by the resume token for that bro.
+func MakeWelcome(token uint64) []byte {
+	payload := binary.LittleEndian.AppendUint64([]byte("ok"), token)
+	return Make(Info, 0, payload)
+}
+
+// ParseWelcome returns the resume token of a welcome payload.
+func ParseWelcome(bs []byte) (uint64, error) {
+	if len(bs) != 2+8 || string(bs[:2]) != "ok" {
+		return 0, errors.New("not a welcome")
+	}
+	return binary.LittleEndian.Uint64(bs[2:]), nil
+}
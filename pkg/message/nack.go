@@ -0,0 +1,59 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// maxNackSequences keeps a nack within one small datagram.
+const maxNackSequences = 256
+
+// Missing is the payload of the Nack message a bro sends to ask the bro
+// with session Target to send the chunks of frame FrameId it is missing
+// again.
+type Missing struct {
+	Target    uint32
+	FrameId   uint32
+	Sequences []uint16
+}
+
+// Encode lays the nack out as [target uint32][frame id uint32] followed
+// by a uint16 for every sequence number.
+func (n Missing) Encode() []byte {
+	sequences := n.Sequences
+	if len(sequences) > maxNackSequences {
+		sequences = sequences[:maxNackSequences]
+	}
+	buf := make([]byte, 0, 8+2*len(sequences))
+	buf = binary.LittleEndian.AppendUint32(buf, n.Target)
+	buf = binary.LittleEndian.AppendUint32(buf, n.FrameId)
+	for _, seq := range sequences {
+		buf = binary.LittleEndian.AppendUint16(buf, seq)
+	}
+	return buf
+}
+
+func (n *Missing) Decode(bs []byte) error {
+	if len(bs) < 8 {
+		return errors.New("nack too small")
+	}
+	if len(bs)%2 != 0 {
+		return errors.New("nack truncated")
+	}
+
+	n.Target = binary.LittleEndian.Uint32(bs[:4])
+	n.FrameId = binary.LittleEndian.Uint32(bs[4:8])
+	bs = bs[8:]
+	n.Sequences = make([]uint16, 0, len(bs)/2)
+	for i := 0; i < len(bs); i += 2 {
+		n.Sequences = append(n.Sequences, binary.LittleEndian.Uint16(bs[i:i+2]))
+	}
+
+	return nil
+}
+
+// MakeNack is passed on by the server to the bro with session n.Target
+// alone.
+func MakeNack(session uint32, n Missing) []byte {
+	return Make(Nack, session, n.Encode())
+}
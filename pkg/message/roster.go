@@ -0,0 +1,73 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Peer is one bro in a room as announced by the server.
+type Peer struct {
+	Session uint32
+	Name    string
+	// Color is the color mode the peer's terminal can show
+	Color uint8
+	// Codecs has a bit set for every audio codec the peer can decode
+	Codecs uint8
+}
+
+// Peers is the payload of the Roster message the server sends to every
+// bro in a room whenever someone joins or leaves it.
+type Peers []Peer
+
+// Encode lays the peers out as [count] followed by
+// [session uint32][color][codecs][name length][name] for each peer.
+func (r Peers) Encode() []byte {
+	peers := r
+	if len(peers) > 255 {
+		peers = peers[:255]
+	}
+	buf := []byte{uint8(len(peers))}
+	for _, p := range peers {
+		name := p.Name
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, p.Session)
+		buf = append(buf, p.Color, p.Codecs)
+		buf = append(buf, uint8(len(name)))
+		buf = append(buf, name...)
+	}
+	return buf
+}
+
+func (r *Peers) Decode(bs []byte) error {
+	if len(bs) < 1 {
+		return errors.New("roster too small")
+	}
+
+	count := int(bs[0])
+	bs = bs[1:]
+
+	peers := make(Peers, 0, count)
+	for range count {
+		if len(bs) < 7 {
+			return errors.New("roster peer truncated")
+		}
+		session := binary.LittleEndian.Uint32(bs[:4])
+		color, codecs := bs[4], bs[5]
+		nameLen := int(bs[6])
+		bs = bs[7:]
+		if len(bs) < nameLen {
+			return errors.New("roster name truncated")
+		}
+		peers = append(peers, Peer{Session: session, Name: string(bs[:nameLen]), Color: color, Codecs: codecs})
+		bs = bs[nameLen:]
+	}
+
+	*r = peers
+	return nil
+}
+
+func MakeRoster(session uint32, r Peers) []byte {
+	return Make(Roster, session, r.Encode())
+}
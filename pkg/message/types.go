@@ -1,43 +1,183 @@
 package message
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
 type MessageType uint8
 
 const (
-	Info    MessageType = iota
-	Frame   MessageType = 1
-	Audio   MessageType = 2
-	Error   MessageType = 99
-	Unknown MessageType = 255
+	Info     MessageType = iota
+	Frame    MessageType = 1
+	Audio    MessageType = 2
+	Roster   MessageType = 3
+	Ping     MessageType = 4
+	Pong     MessageType = 5
+	Left     MessageType = 6
+	Keyframe MessageType = 7
+	Loss     MessageType = 8
+	Nack     MessageType = 9
+	Error    MessageType = 99
+	Unknown  MessageType = 255
+)
+
+// Version is the wire protocol version spoken by this build. The
+// unversioned protocol used 0, 1, 2 and 99 as its leading byte, so
+// numbering starts past those to keep old peers distinguishable.
+const Version uint8 = 3
+
+// HeaderSize is the number of bytes preceding every payload:
+// version, type, flags, session id (uint32) and payload length (uint16).
+const HeaderSize = 9
+
+var (
+	ErrTooShort       = errors.New("message shorter than header")
+	ErrLengthMismatch = errors.New("message payload length mismatch")
 )
 
-func Parse(data []byte) ([]byte, MessageType) {
-	switch data[0] {
-	case 0:
-		return data[1:], Info
-	case 1:
-		return data[1:], Frame
-	case 2:
-		return data[1:], Audio
-	case 99:
-		return data[1:], Error
+// VersionError is returned by Parse when the peer speaks a different
+// protocol version.
+type VersionError struct {
+	Version uint8
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("protocol version mismatch: got %d, want %d", e.Version, Version)
+}
+
+type Header struct {
+	Version uint8
+	Type    MessageType
+	Flags   uint8
+	Session uint32
+	Length  uint16
+}
+
+// Encode writes the header followed by payload, filling in the version
+// and payload length.
+func (h Header) Encode(payload []byte) []byte {
+	buf := make([]byte, HeaderSize+len(payload))
+	buf[0] = Version
+	buf[1] = byte(h.Type)
+	buf[2] = h.Flags
+	binary.LittleEndian.PutUint32(buf[3:7], h.Session)
+	binary.LittleEndian.PutUint16(buf[7:9], uint16(len(payload)))
+	copy(buf[HeaderSize:], payload)
+	return buf
+}
+
+// Parse splits a datagram into its header and payload. Unrecognised
+// message types are reported as Unknown rather than as an error.
+func Parse(data []byte) (Header, []byte, error) {
+	var h Header
+
+	if len(data) == 0 {
+		return h, nil, ErrTooShort
+	}
+
+	if data[0] != Version {
+		return h, nil, &VersionError{Version: data[0]}
+	}
+
+	if len(data) < HeaderSize {
+		return h, nil, ErrTooShort
+	}
+
+	h.Version = data[0]
+	h.Type = MessageType(data[1])
+	h.Flags = data[2]
+	h.Session = binary.LittleEndian.Uint32(data[3:7])
+	h.Length = binary.LittleEndian.Uint16(data[7:9])
+
+	payload := data[HeaderSize:]
+	if len(payload) != int(h.Length) {
+		return h, nil, ErrLengthMismatch
+	}
+
+	switch h.Type {
+	case Info, Frame, Audio, Roster, Ping, Pong, Left, Keyframe, Loss, Nack, Error:
 	default:
-		return data, Unknown
+		h.Type = Unknown
 	}
 
+	return h, payload, nil
+}
+
+func Make(t MessageType, session uint32, payload []byte) []byte {
+	h := Header{Type: t, Session: session}
+	return h.Encode(payload)
+}
+
+func MakeError(session uint32, e string) []byte {
+	return Make(Error, session, []byte(e))
+}
+
+func MakeInfo(session uint32, msg string) []byte {
+	return Make(Info, session, []byte(msg))
+}
+
+func MakeFrame(session uint32, data []byte) []byte {
+	return Make(Frame, session, data)
+}
+
+func MakeAudio(session uint32, data []byte) []byte {
+	return Make(Audio, session, data)
 }
 
-func MakeError(e string) []byte {
-	return append([]byte{byte(Error)}, []byte(e)...)
+// MakePing carries an opaque payload that the receiver echoes back in
+// its Pong.
+func MakePing(session uint32, data []byte) []byte {
+	return Make(Ping, session, data)
 }
 
-func MakeInfo(msg string) []byte {
-	return append([]byte{byte(Info)}, []byte(msg)...)
+func MakePong(session uint32, data []byte) []byte {
+	return Make(Pong, session, data)
 }
 
-func MakeFrame(data []byte) []byte {
-	return append([]byte{byte(Frame)}, data...)
+// MakeLeft tells the bros in a room that the bro with session has gone.
+func MakeLeft(session uint32, name string) []byte {
+	return Make(Left, session, []byte(name))
 }
 
-func MakeAudio(data []byte) []byte {
-	return append([]byte{byte(Audio)}, data...)
+// MakeKeyframe asks the bro with session target to send a keyframe,
+// which the server passes on to that bro alone.
+func MakeKeyframe(session uint32, target uint32) []byte {
+	return Make(Keyframe, session, binary.LittleEndian.AppendUint32(nil, target))
+}
+
+// ParseKeyframe returns the session a Keyframe message is meant for.
+func ParseKeyframe(bs []byte) (uint32, error) {
+	if len(bs) != 4 {
+		return 0, errors.New("keyframe request not 4 bytes")
+	}
+	return binary.LittleEndian.Uint32(bs), nil
+}
+
+// MakeLoss tells the bro with session target what fraction of its frame
+// chunks, in thousandths, did not arrive. The server passes it on to
+// that bro alone.
+func MakeLoss(session uint32, target uint32, permille uint16) []byte {
+	payload := binary.LittleEndian.AppendUint32(nil, target)
+	payload = binary.LittleEndian.AppendUint16(payload, permille)
+	return Make(Loss, session, payload)
+}
+
+// ParseLoss returns the session a Loss message is meant for and the loss
+// it reports.
+func ParseLoss(bs []byte) (uint32, uint16, error) {
+	if len(bs) != 6 {
+		return 0, 0, errors.New("loss report not 6 bytes")
+	}
+	return binary.LittleEndian.Uint32(bs[:4]), binary.LittleEndian.Uint16(bs[4:]), nil
+}
+
+// Target returns the session of the bro a Keyframe, Loss or Nack message
+// is meant for, which leads all their payloads.
+func Target(bs []byte) (uint32, error) {
+	if len(bs) < 4 {
+		return 0, errors.New("no target session")
+	}
+	return binary.LittleEndian.Uint32(bs[:4]), nil
 }
@@ -0,0 +1,206 @@
+package message
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		msg := MakeFrame(42, []byte{1, 2, 3})
+
+		h, data, err := Parse(msg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := Header{Version: Version, Type: Frame, Session: 42, Length: 3}
+		if h != expected {
+			t.Errorf("header mismatch\nGot:     %+v\nExpected:%+v", h, expected)
+		}
+		if !reflect.DeepEqual(data, []byte{1, 2, 3}) {
+			t.Errorf("payload mismatch: %v", data)
+		}
+	})
+
+	t.Run("empty datagram", func(t *testing.T) {
+		if _, _, err := Parse(nil); !errors.Is(err, ErrTooShort) {
+			t.Errorf("expected ErrTooShort, got %v", err)
+		}
+	})
+
+	t.Run("truncated header", func(t *testing.T) {
+		if _, _, err := Parse([]byte{Version, byte(Info)}); !errors.Is(err, ErrTooShort) {
+			t.Errorf("expected ErrTooShort, got %v", err)
+		}
+	})
+
+	t.Run("truncated payload", func(t *testing.T) {
+		msg := MakeInfo(1, "bro")
+		if _, _, err := Parse(msg[:len(msg)-1]); !errors.Is(err, ErrLengthMismatch) {
+			t.Errorf("expected ErrLengthMismatch, got %v", err)
+		}
+	})
+
+	t.Run("unversioned peer", func(t *testing.T) {
+		_, _, err := Parse([]byte{0, 'b', 'r', 'o'})
+		var versionErr *VersionError
+		if !errors.As(err, &versionErr) {
+			t.Fatalf("expected VersionError, got %v", err)
+		}
+		if versionErr.Version != 0 {
+			t.Errorf("expected version 0, got %d", versionErr.Version)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		h, _, err := Parse(Make(MessageType(42), 0, nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if h.Type != Unknown {
+			t.Errorf("expected Unknown, got %d", h.Type)
+		}
+	})
+}
+
+func TestJoin(t *testing.T) {
+	join := Join{Room: "standup", Name: "bro", Token: 1 << 40, Color: 2, Codecs: 0x0f}
+
+	h, data, err := Parse(MakeJoin(7, join))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.Type != Info {
+		t.Errorf("expected Info, got %d", h.Type)
+	}
+
+	var decoded Join
+	if err := decoded.Decode(data); err != nil {
+		t.Fatalf("error decoding join: %v", err)
+	}
+	if decoded != join {
+		t.Errorf("join mismatch\nGot:     %+v\nExpected:%+v", decoded, join)
+	}
+
+	if err := decoded.Decode([]byte{5, 'a'}); err == nil {
+		t.Errorf("expected error for truncated room")
+	}
+
+	t.Run("long name", func(t *testing.T) {
+		long := Join{Room: "standup", Name: strings.Repeat("bro", 200)}
+		var decoded Join
+		if err := decoded.Decode(long.Encode()); err != nil {
+			t.Fatalf("error decoding join: %v", err)
+		}
+		if decoded.Name != long.Name[:255] {
+			t.Errorf("Expected: a name of 255 bytes\nGot: %d", len(decoded.Name))
+		}
+
+		// a bro that does not cut its name is cut by the server
+		payload := append(Join{Room: "standup"}.Encode(), long.Name...)
+		if err := decoded.Decode(payload); err != nil {
+			t.Fatalf("error decoding join: %v", err)
+		}
+		if len(decoded.Name) != 255 {
+			t.Errorf("Expected: a name of 255 bytes\nGot: %d", len(decoded.Name))
+		}
+	})
+}
+
+func TestWelcome(t *testing.T) {
+	_, data, err := Parse(MakeWelcome(1234))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token, err := ParseWelcome(data)
+	if err != nil {
+		t.Fatalf("error parsing welcome: %v", err)
+	}
+	if token != 1234 {
+		t.Errorf("expected token 1234, got %d", token)
+	}
+
+	if _, err := ParseWelcome([]byte("full")); err == nil {
+		t.Errorf("expected error for non-welcome payload")
+	}
+}
+
+func TestRoster(t *testing.T) {
+	roster := Peers{{Session: 1, Name: "bro", Color: 1, Codecs: 0x0f}, {Session: 2, Name: "other bro"}}
+
+	var decoded Peers
+	if err := decoded.Decode(roster.Encode()); err != nil {
+		t.Fatalf("error decoding roster: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, roster) {
+		t.Errorf("roster mismatch\nGot:     %+v\nExpected:%+v", decoded, roster)
+	}
+
+	if err := decoded.Decode([]byte{2, 1, 0, 0, 0, 0, 0}); err == nil {
+		t.Errorf("expected error for truncated roster")
+	}
+}
+
+func TestKeyframe(t *testing.T) {
+	h, data, err := Parse(MakeKeyframe(1, 42))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.Type != Keyframe || h.Session != 1 {
+		t.Errorf("expected a keyframe request from 1, got type %d from %d", h.Type, h.Session)
+	}
+
+	target, err := ParseKeyframe(data)
+	if err != nil {
+		t.Fatalf("error parsing keyframe request: %v", err)
+	}
+	if target != 42 {
+		t.Errorf("expected target 42, got %d", target)
+	}
+}
+
+func TestLoss(t *testing.T) {
+	h, data, err := Parse(MakeLoss(1, 42, 35))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.Type != Loss {
+		t.Errorf("expected a loss report, got type %d", h.Type)
+	}
+
+	target, permille, err := ParseLoss(data)
+	if err != nil {
+		t.Fatalf("error parsing loss report: %v", err)
+	}
+	if target != 42 || permille != 35 {
+		t.Errorf("expected 35‰ for 42, got %d‰ for %d", permille, target)
+	}
+}
+
+func TestNack(t *testing.T) {
+	missing := Missing{Target: 42, FrameId: 7, Sequences: []uint16{1, 3, 300}}
+
+	h, data, err := Parse(MakeNack(1, missing))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.Type != Nack {
+		t.Errorf("expected a nack, got type %d", h.Type)
+	}
+
+	var decoded Missing
+	if err := decoded.Decode(data); err != nil {
+		t.Fatalf("error decoding nack: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, missing) {
+		t.Errorf("Expected: %+v\nGot: %+v", missing, decoded)
+	}
+
+	if err := decoded.Decode(data[:9]); err == nil {
+		t.Errorf("expected error for truncated nack")
+	}
+}
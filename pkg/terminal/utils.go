@@ -26,3 +26,23 @@ func MoveAndWrite(row, col int, char rune) {
 	MoveCursor(row, col)
 	fmt.Printf("%c", char)
 }
+
+// Size returns the terminal's rows and columns, falling back to 24x80
+// when they cannot be determined.
+func Size() (int, int) {
+	rows, cols := 24, 80
+	if runtime.GOOS == "windows" {
+		return rows, cols
+	}
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return rows, cols
+	}
+	var r, c int
+	if _, err := fmt.Sscan(string(out), &r, &c); err != nil || r <= 0 || c <= 0 {
+		return rows, cols
+	}
+	return r, c
+}
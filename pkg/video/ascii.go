@@ -2,40 +2,34 @@ package video
 
 import (
 	"image"
-
-	"gocv.io/x/gocv"
+	"image/color"
 )
 
 // Define ASCII characters from dark to light
 var asciiChars = " .:-=+*#%@"
 
-// Function to convert frame to ASCII art
-func frameToAscii(frame gocv.Mat, width int) [][]rune {
-	// Convert the frame to grayscale
-	defer frame.Close()
-	gray := gocv.NewMat()
-	defer gray.Close()
-	gocv.CvtColor(frame, &gray, gocv.ColorBGRToGray)
-
-	// Resize the frame to a smaller size for better ASCII art visualization
-	aspectRatio := float64(gray.Rows()) / float64(gray.Cols())
-	height := int(float64(width) * aspectRatio * 0.75)
+// charAspect squashes the height because terminal cells are taller than
+// they are wide.
+const charAspect = 0.75
 
-	resized := gocv.NewMat()
-	defer resized.Close()
-	gocv.Resize(gray, &resized, image.Point{X: width, Y: height}, 0, 0, gocv.InterpolationArea)
+// ImageToAscii converts img to ASCII art width columns wide. Every cell
+// is the average brightness of the pixels it covers.
+func ImageToAscii(img image.Image, width int) Frame {
+	gray, imgWidth, imgHeight := grayscale(img)
+	if imgWidth == 0 || imgHeight == 0 || width <= 0 {
+		return Frame{}
+	}
 
-	rows, cols := resized.Rows(), resized.Cols()
+	aspectRatio := float64(imgHeight) / float64(imgWidth)
+	height := max(int(float64(width)*aspectRatio*charAspect), 1)
 
-	runeFrame := make([][]rune, rows)
-	for rowIdx := range rows {
-		runeFrame[rowIdx] = make([]rune, cols)
-	}
+	cells := areaAverage(gray, imgWidth, imgHeight, width, height)
 
-	// Map each pixel to an ASCII character based on intensity
-	for rowIdx := 0; rowIdx < rows; rowIdx++ {
-		for colIdx := 0; colIdx < cols; colIdx++ {
-			pixel := resized.GetUCharAt(rowIdx, colIdx)
+	runeFrame := make(Frame, height)
+	for rowIdx := range height {
+		runeFrame[rowIdx] = make([]rune, width)
+		for colIdx := range width {
+			pixel := cells[rowIdx*width+colIdx]
 			index := int(float64(pixel) / 255.0 * float64(len(asciiChars)-1))
 			runeFrame[rowIdx][colIdx] = rune(asciiChars[index])
 		}
@@ -44,6 +38,176 @@ func frameToAscii(frame gocv.Mat, width int) [][]rune {
 	return runeFrame
 }
 
+// ImageToColorAscii is ImageToAscii that also colors every glyph with
+// the average color of the pixels under it.
+func ImageToColorAscii(img image.Image, width int) ColorFrame {
+	frame := ImageToAscii(img, width)
+	if len(frame) == 0 {
+		return ColorFrame{Frame: frame}
+	}
+	height := len(frame)
+
+	r, g, b, w, h := channels(img)
+	rs := areaAverage(r, w, h, width, height)
+	gs := areaAverage(g, w, h, width, height)
+	bs := areaAverage(b, w, h, width, height)
+
+	fg := make([][]Color, height)
+	for rowIdx := range height {
+		fg[rowIdx] = make([]Color, width)
+		for colIdx := range width {
+			i := rowIdx*width + colIdx
+			fg[rowIdx][colIdx] = Color{rs[i], gs[i], bs[i]}
+		}
+	}
+
+	return ColorFrame{Frame: frame, FG: fg}
+}
+
+// ImageToHalfBlock converts img to half blocks width columns wide, with
+// twice the rows of pixels ImageToAscii has. The upper pixel of a cell is
+// its foreground color and the lower one its background color, while the
+// glyph alone tells which halves are brighter than mid gray.
+func ImageToHalfBlock(img image.Image, width int) ColorFrame {
+	gray, imgWidth, imgHeight := grayscale(img)
+	if imgWidth == 0 || imgHeight == 0 || width <= 0 {
+		return ColorFrame{Frame: Frame{}, Charset: HalfBlock}
+	}
+
+	aspectRatio := float64(imgHeight) / float64(imgWidth)
+	height := max(int(float64(width)*aspectRatio*charAspect), 1)
+
+	r, g, b, _, _ := channels(img)
+	grays := areaAverage(gray, imgWidth, imgHeight, width, 2*height)
+	rs := areaAverage(r, imgWidth, imgHeight, width, 2*height)
+	gs := areaAverage(g, imgWidth, imgHeight, width, 2*height)
+	bs := areaAverage(b, imgWidth, imgHeight, width, 2*height)
+
+	frame := ColorFrame{
+		Frame:   make(Frame, height),
+		FG:      make([][]Color, height),
+		BG:      make([][]Color, height),
+		Charset: HalfBlock,
+	}
+	for rowIdx := range height {
+		frame.Frame[rowIdx] = make([]rune, width)
+		frame.FG[rowIdx] = make([]Color, width)
+		frame.BG[rowIdx] = make([]Color, width)
+		for colIdx := range width {
+			upper := 2*rowIdx*width + colIdx
+			lower := upper + width
+
+			var index int
+			if grays[upper] >= 128 {
+				index |= 1
+			}
+			if grays[lower] >= 128 {
+				index |= 2
+			}
+			frame.Frame[rowIdx][colIdx] = halfBlocks[index]
+			frame.FG[rowIdx][colIdx] = Color{rs[upper], gs[upper], bs[upper]}
+			frame.BG[rowIdx][colIdx] = Color{rs[lower], gs[lower], bs[lower]}
+		}
+	}
+
+	return frame
+}
+
+// channels splits img into red, green and blue planes in row-major order.
+func channels(img image.Image) ([]uint8, []uint8, []uint8, int, int) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	r, g, b := make([]uint8, w*h), make([]uint8, w*h), make([]uint8, w*h)
+
+	switch src := img.(type) {
+	case *image.RGBA:
+		for y := range h {
+			offset := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x := range w {
+				p := src.Pix[offset+x*4 : offset+x*4+3]
+				r[y*w+x], g[y*w+x], b[y*w+x] = p[0], p[1], p[2]
+			}
+		}
+	default:
+		for y := range h {
+			for x := range w {
+				c := color.RGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+				r[y*w+x], g[y*w+x], b[y*w+x] = c.R, c.G, c.B
+			}
+		}
+	}
+
+	return r, g, b, w, h
+}
+
+// grayscale returns the luma of every pixel in row-major order, reading
+// the common image types directly instead of through At.
+func grayscale(img image.Image) ([]uint8, int, int) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gray := make([]uint8, w*h)
+
+	switch src := img.(type) {
+	case *image.Gray:
+		for y := range h {
+			offset := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			copy(gray[y*w:(y+1)*w], src.Pix[offset:offset+w])
+		}
+	case *image.YCbCr:
+		for y := range h {
+			for x := range w {
+				gray[y*w+x] = src.Y[src.YOffset(bounds.Min.X+x, bounds.Min.Y+y)]
+			}
+		}
+	case *image.RGBA:
+		for y := range h {
+			offset := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			for x := range w {
+				p := src.Pix[offset+x*4 : offset+x*4+3]
+				gray[y*w+x] = luma(p[0], p[1], p[2])
+			}
+		}
+	default:
+		for y := range h {
+			for x := range w {
+				c := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+				gray[y*w+x] = c.Y
+			}
+		}
+	}
+
+	return gray, w, h
+}
+
+// luma uses the same ITU-R BT.601 weights as OpenCV's BGR2GRAY.
+func luma(r, g, b uint8) uint8 {
+	return uint8((299*uint32(r) + 587*uint32(g) + 114*uint32(b) + 500) / 1000)
+}
+
+// areaAverage downscales a w x h grayscale image to width x height by
+// averaging the block of source pixels under every target pixel.
+func areaAverage(gray []uint8, w, h, width, height int) []uint8 {
+	out := make([]uint8, width*height)
+	for rowIdx := range height {
+		y0 := rowIdx * h / height
+		y1 := max((rowIdx+1)*h/height, y0+1)
+		for colIdx := range width {
+			x0 := colIdx * w / width
+			x1 := max((colIdx+1)*w/width, x0+1)
+
+			var sum, n uint32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += uint32(gray[y*w+x])
+					n++
+				}
+			}
+			out[rowIdx*width+colIdx] = uint8(sum / n)
+		}
+	}
+	return out
+}
+
 func (f Frame) String() string {
 	var output string
 	for rowIdx := range f {
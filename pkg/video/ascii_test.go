@@ -0,0 +1,93 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestImageToAscii(t *testing.T) {
+	t.Run("dimensions and aspect", func(t *testing.T) {
+		img := image.NewGray(image.Rect(0, 0, 640, 480))
+		frame := ImageToAscii(img, 80)
+
+		if len(frame) != 45 || len(frame[0]) != 80 {
+			t.Errorf("expected 80x45, got %dx%d", len(frame[0]), len(frame))
+		}
+	})
+
+	t.Run("area average", func(t *testing.T) {
+		// each 2x2 block averages to 0, 127 or 255
+		img := image.NewGray(image.Rect(0, 0, 6, 2))
+		for y := range 2 {
+			for x := range 6 {
+				var v uint8
+				switch {
+				case x >= 4:
+					v = 255
+				case x >= 2 && (x+y)%2 == 0:
+					v = 255
+				}
+				img.SetGray(x, y, color.Gray{Y: v})
+			}
+		}
+
+		frame := ImageToAscii(img, 3)
+		expected := " =@"
+		if len(frame) != 1 || string(frame[0]) != expected {
+			t.Errorf("expected %q, got %q", expected, frame.String())
+		}
+	})
+
+	t.Run("color images use luma", func(t *testing.T) {
+		rgba := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		ycbcr := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio444)
+		nrgba := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		white := color.RGBA{255, 255, 255, 255}
+		for y := range 4 {
+			for x := range 4 {
+				rgba.Set(x, y, white)
+				nrgba.Set(x, y, white)
+				ycbcr.Y[ycbcr.YOffset(x, y)] = 255
+			}
+		}
+
+		for name, img := range map[string]image.Image{"rgba": rgba, "ycbcr": ycbcr, "nrgba": nrgba} {
+			frame := ImageToAscii(img, 2)
+			if frame[0][0] != '@' {
+				t.Errorf("%s: expected '@' for white, got %q", name, frame[0][0])
+			}
+		}
+	})
+
+	t.Run("empty image", func(t *testing.T) {
+		if frame := ImageToAscii(image.NewGray(image.Rectangle{}), 10); len(frame) != 0 {
+			t.Errorf("expected empty frame, got %d rows", len(frame))
+		}
+	})
+}
+
+func TestImageToHalfBlock(t *testing.T) {
+	// white over red, one pixel row per half of the cells
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := range 4 {
+		img.Set(x, 0, color.RGBA{255, 255, 255, 255})
+		img.Set(x, 1, color.RGBA{255, 0, 0, 255})
+	}
+
+	frame := ImageToHalfBlock(img, 4)
+	if len(frame.Frame) != 1 || len(frame.Frame[0]) != 4 {
+		t.Fatalf("expected 4x1, got %dx%d", len(frame.Frame[0]), len(frame.Frame))
+	}
+
+	// red is darker than mid gray, so only the upper half is lit
+	if frame.Frame[0][0] != '▀' {
+		t.Errorf("expected '▀', got %q", frame.Frame[0][0])
+	}
+	if expected := (Color{255, 255, 255}); frame.FG[0][0] != expected {
+		t.Errorf("Expected: %v\nGot: %v", expected, frame.FG[0][0])
+	}
+	if expected := (Color{255, 0, 0}); frame.BG[0][0] != expected {
+		t.Errorf("Expected: %v\nGot: %v", expected, frame.BG[0][0])
+	}
+}
@@ -0,0 +1,80 @@
+package video
+
+import "image"
+
+// brailleDots are the bits of the braille dots, indexed by the row and
+// column of the dot in its 2x4 block.
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// ImageToBraille converts img to braille patterns width columns wide,
+// every cell showing a 2x4 block of pixels as dots. Brightness is
+// reduced to dot or no dot with Floyd-Steinberg dithering, and each cell
+// is colored with the average color of its block.
+func ImageToBraille(img image.Image, width int) ColorFrame {
+	gray, imgWidth, imgHeight := grayscale(img)
+	if imgWidth == 0 || imgHeight == 0 || width <= 0 {
+		return ColorFrame{Frame: Frame{}, Charset: Braille}
+	}
+
+	aspectRatio := float64(imgHeight) / float64(imgWidth)
+	height := max(int(float64(width)*aspectRatio*charAspect), 1)
+
+	dots := dither(areaAverage(gray, imgWidth, imgHeight, 2*width, 4*height), 2*width, 4*height)
+
+	frame := ImageToColorAscii(img, width)
+	frame.Charset = Braille
+	for rowIdx := range height {
+		for colIdx := range width {
+			char := rune(brailleBase)
+			for y := range 4 {
+				for x := range 2 {
+					if dots[(4*rowIdx+y)*2*width+2*colIdx+x] {
+						char |= brailleDots[y][x]
+					}
+				}
+			}
+			frame.Frame[rowIdx][colIdx] = char
+		}
+	}
+
+	return frame
+}
+
+// dither reduces a w x h grayscale image to lit and unlit pixels,
+// spreading the error of every pixel over its unvisited neighbours.
+func dither(gray []uint8, w, h int) []bool {
+	errs := make([]int, len(gray))
+	for i, v := range gray {
+		errs[i] = int(v)
+	}
+
+	lit := make([]bool, len(gray))
+	for y := range h {
+		for x := range w {
+			i := y*w + x
+			old := errs[i]
+			if old >= 128 {
+				lit[i] = true
+				old -= 255
+			}
+			if x+1 < w {
+				errs[i+1] += old * 7 / 16
+			}
+			if y+1 < h {
+				if x > 0 {
+					errs[i+w-1] += old * 3 / 16
+				}
+				errs[i+w] += old * 5 / 16
+				if x+1 < w {
+					errs[i+w+1] += old / 16
+				}
+			}
+		}
+	}
+	return lit
+}
@@ -0,0 +1,66 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestImageToBraille(t *testing.T) {
+	t.Run("dots", func(t *testing.T) {
+		// 4x4 pixels upscaled to two cells of 2x4 dots: the left cell
+		// has its left column lit, the right cell is all lit
+		img := image.NewGray(image.Rect(0, 0, 4, 4))
+		for y := range 4 {
+			img.SetGray(0, y, color.Gray{Y: 255})
+			img.SetGray(2, y, color.Gray{Y: 255})
+			img.SetGray(3, y, color.Gray{Y: 255})
+		}
+
+		frame := ImageToBraille(img, 2)
+		expected := Frame{{'⡇', '⣿'}}
+		if !reflect.DeepEqual(frame.Frame, expected) {
+			t.Errorf("Expected: %q\nGot: %q", expected.String(), frame.Frame.String())
+		}
+	})
+
+	t.Run("dithering keeps the brightness", func(t *testing.T) {
+		img := image.NewGray(image.Rect(0, 0, 80, 80))
+		for y := range 80 {
+			for x := range 80 {
+				img.SetGray(x, y, color.Gray{Y: 64})
+			}
+		}
+
+		frame := ImageToBraille(img, 40)
+		var dots, total int
+		for _, row := range frame.Frame {
+			for _, char := range row {
+				for bits := char - brailleBase; bits > 0; bits >>= 1 {
+					dots += int(bits & 1)
+				}
+				total += 8
+			}
+		}
+		// a quarter bright gray lights about a quarter of the dots
+		if ratio := float64(dots) / float64(total); ratio < 0.2 || ratio > 0.3 {
+			t.Errorf("expected about 25%% of the dots lit, got %.0f%%", ratio*100)
+		}
+	})
+}
+
+func TestEncodeBrailleFrame(t *testing.T) {
+	frame := ColorFrame{
+		Frame:   Frame{{'⠀', '⡇', '⡇'}, {'⣿', '⣿', '⠁'}},
+		Charset: Braille,
+	}
+
+	decoded, err := DecodeFrame(EncodeFrame(frame, Mono))
+	if err != nil {
+		t.Fatalf("error decoding: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, frame) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", frame.Frame, decoded.Frame)
+	}
+}
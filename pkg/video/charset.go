@@ -0,0 +1,83 @@
+package video
+
+import (
+	"fmt"
+	"image"
+)
+
+// Charset is the set of glyphs a frame is drawn with.
+type Charset uint8
+
+const (
+	// ASCII draws one pixel per cell with asciiChars
+	ASCII Charset = iota
+	// HalfBlock draws two pixels per cell, one above the other
+	HalfBlock
+	// Braille draws a 2x4 block of black or white pixels per cell
+	Braille
+)
+
+// upperHalf is drawn with the upper pixel in the foreground color and the
+// lower one in the background color.
+const upperHalf = '▀'
+
+// halfBlocks are the glyphs of HalfBlock frames without colors, which
+// light the upper, lower or both halves of a cell.
+var halfBlocks = []rune{' ', upperHalf, '▄', '█'}
+
+// brailleBase is the empty braille pattern, each of the 8 dots adding a
+// bit to it.
+const brailleBase = 0x2800
+
+func (c Charset) String() string {
+	switch c {
+	case HalfBlock:
+		return "halfblock"
+	case Braille:
+		return "braille"
+	default:
+		return "ascii"
+	}
+}
+
+// ParseCharset reads a -charset flag value.
+func ParseCharset(s string) (Charset, error) {
+	switch s {
+	case "ascii", "":
+		return ASCII, nil
+	case "halfblock":
+		return HalfBlock, nil
+	case "braille":
+		return Braille, nil
+	}
+	return ASCII, fmt.Errorf("unknown charset %q", s)
+}
+
+// Convert turns img into a frame width columns wide drawn with c.
+func (c Charset) Convert(img image.Image, width int) ColorFrame {
+	switch c {
+	case HalfBlock:
+		return ImageToHalfBlock(img, width)
+	case Braille:
+		return ImageToBraille(img, width)
+	default:
+		return ImageToColorAscii(img, width)
+	}
+}
+
+// glyph is the character unversioned frames sent as b: the character
+// itself for ASCII, its index in halfBlocks for HalfBlock and its offset
+// from brailleBase for Braille.
+func (c Charset) glyph(b byte) rune {
+	switch c {
+	case HalfBlock:
+		if int(b) < len(halfBlocks) {
+			return halfBlocks[b]
+		}
+		return ' '
+	case Braille:
+		return brailleBase + rune(b)
+	default:
+		return rune(b)
+	}
+}
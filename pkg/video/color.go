@@ -0,0 +1,201 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Color is the 24-bit color of a cell.
+type Color struct {
+	R, G, B uint8
+}
+
+// ColorMode is how many colors a terminal can show, from least to most.
+type ColorMode uint8
+
+const (
+	Mono ColorMode = iota
+	Color256
+	TrueColor
+)
+
+func (m ColorMode) String() string {
+	switch m {
+	case Color256:
+		return "256"
+	case TrueColor:
+		return "truecolor"
+	default:
+		return "mono"
+	}
+}
+
+// ParseColorMode reads a -color flag value; "auto" asks the terminal.
+func ParseColorMode(s string) (ColorMode, error) {
+	switch s {
+	case "auto", "":
+		return DetectColorMode(), nil
+	case "mono":
+		return Mono, nil
+	case "256":
+		return Color256, nil
+	case "truecolor":
+		return TrueColor, nil
+	}
+	return Mono, fmt.Errorf("unknown color mode %q", s)
+}
+
+// DetectColorMode guesses the terminal's color support from the
+// environment the way most terminal programs do.
+func DetectColorMode() ColorMode {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return TrueColor
+	}
+	if strings.Contains(os.Getenv("TERM"), "256color") {
+		return Color256
+	}
+	return Mono
+}
+
+// ColorFrame is a Frame with a color for every glyph.
+type ColorFrame struct {
+	Frame
+	// FG holds the glyph colors, nil for a monochrome frame
+	FG [][]Color
+	// BG holds the background colors of HalfBlock frames, the color of
+	// the lower pixel of every cell
+	BG      [][]Color
+	Charset Charset
+}
+
+// cube are the channel levels of the 6x6x6 color cube at 16-231 of the
+// xterm 256 color palette; 232-255 are a gray ramp.
+var cube = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// To256 returns the xterm 256 color palette entry nearest to c, from
+// either the color cube or the gray ramp.
+func To256(c Color) uint8 {
+	r, g, b := cubeIndex(c.R), cubeIndex(c.G), cubeIndex(c.B)
+	cubeColor := Color{cube[r], cube[g], cube[b]}
+
+	avg := (int(c.R) + int(c.G) + int(c.B)) / 3
+	grayIdx := min(max((avg-8+5)/10, 0), 23)
+	grayLevel := uint8(8 + grayIdx*10)
+	gray := Color{grayLevel, grayLevel, grayLevel}
+
+	if distance(c, gray) < distance(c, cubeColor) {
+		return uint8(232 + grayIdx)
+	}
+	return uint8(16 + 36*r + 6*g + b)
+}
+
+// From256 returns the color of an xterm 256 palette entry. The first 16
+// system colors vary between terminals and are approximated.
+func From256(idx uint8) Color {
+	switch {
+	case idx >= 232:
+		level := 8 + (idx-232)*10
+		return Color{level, level, level}
+	case idx >= 16:
+		i := idx - 16
+		return Color{cube[i/36], cube[(i/6)%6], cube[i%6]}
+	}
+	level := uint8(0)
+	if idx&8 != 0 {
+		level = 85
+	}
+	bright := level + 170
+	c := Color{level, level, level}
+	if idx&1 != 0 {
+		c.R = bright
+	}
+	if idx&2 != 0 {
+		c.G = bright
+	}
+	if idx&4 != 0 {
+		c.B = bright
+	}
+	return c
+}
+
+func cubeIndex(v uint8) int {
+	if v < 48 {
+		return 0
+	}
+	if v < 115 {
+		return 1
+	}
+	return (int(v) - 35) / 40
+}
+
+func distance(a, b Color) int {
+	dr, dg, db := int(a.R)-int(b.R), int(a.G)-int(b.G), int(a.B)-int(b.B)
+	return dr*dr + dg*dg + db*db
+}
+
+const sgrReset = "\033[0m"
+
+// sgrReverse swaps the foreground and background colors.
+const sgrReverse = "\033[7m"
+
+// sgr returns the escape sequence that sets the foreground to c, or
+// nothing in Mono mode.
+func sgr(c Color, mode ColorMode) string {
+	return sgrColor(38, c, mode)
+}
+
+// sgrBG is sgr for the background.
+func sgrBG(c Color, mode ColorMode) string {
+	return sgrColor(48, c, mode)
+}
+
+func sgrColor(code int, c Color, mode ColorMode) string {
+	switch mode {
+	case TrueColor:
+		return fmt.Sprintf("\033[%d;2;%d;%d;%dm", code, c.R, c.G, c.B)
+	case Color256:
+		return fmt.Sprintf("\033[%d;5;%dm", code, To256(c))
+	}
+	return ""
+}
+
+// cell returns the escape sequence that colors a cell for mode and the
+// glyph drawn after it. Colored half-block cells are always an upper half
+// block, the upper pixel in the foreground over the lower one in the
+// background.
+func (f ColorFrame) cell(rowIdx, colIdx int, mode ColorMode) (string, rune) {
+	char := f.Frame[rowIdx][colIdx]
+	if mode == Mono || f.FG == nil {
+		return "", char
+	}
+	seq := sgr(f.FG[rowIdx][colIdx], mode)
+	if f.BG != nil {
+		seq += sgrBG(f.BG[rowIdx][colIdx], mode)
+		char = upperHalf
+	}
+	return seq, char
+}
+
+// render returns row rowIdx with escape sequences for mode, changing
+// color only where it differs from the previous cell.
+func (f ColorFrame) render(rowIdx int, mode ColorMode) string {
+	row := f.Frame[rowIdx]
+	if mode == Mono || f.FG == nil {
+		return string(row)
+	}
+
+	var b strings.Builder
+	var prev string
+	for colIdx := range row {
+		seq, char := f.cell(rowIdx, colIdx, mode)
+		if seq != prev {
+			b.WriteString(seq)
+			prev = seq
+		}
+		b.WriteRune(char)
+	}
+	b.WriteString(sgrReset)
+	return b.String()
+}
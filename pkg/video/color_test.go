@@ -0,0 +1,86 @@
+package video
+
+import (
+	"testing"
+)
+
+func TestTo256(t *testing.T) {
+	tests := []struct {
+		name     string
+		color    Color
+		expected uint8
+	}{
+		{"black", Color{0, 0, 0}, 16},
+		{"white", Color{255, 255, 255}, 231},
+		{"red", Color{255, 0, 0}, 196},
+		{"cube level", Color{95, 135, 175}, 67},
+		{"gray", Color{128, 128, 128}, 244},
+		{"near red", Color{250, 10, 5}, 196},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := To256(test.color); got != test.expected {
+				t.Errorf("Expected: %d\nGot: %d", test.expected, got)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		for idx := 16; idx < 256; idx++ {
+			if got := To256(From256(uint8(idx))); From256(got) != From256(uint8(idx)) {
+				t.Errorf("Expected: %d\nGot: %d", idx, got)
+			}
+		}
+	})
+}
+
+func TestRender(t *testing.T) {
+	red := Color{255, 0, 0}
+	frame := ColorFrame{
+		Frame: Frame{{'a', 'b', 'c'}},
+		FG:    [][]Color{{red, red, {0, 0, 255}}},
+	}
+
+	tests := []struct {
+		mode     ColorMode
+		expected string
+	}{
+		{Mono, "abc"},
+		{Color256, "\033[38;5;196mab\033[38;5;21mc\033[0m"},
+		{TrueColor, "\033[38;2;255;0;0mab\033[38;2;0;0;255mc\033[0m"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			if got := frame.render(0, test.mode); got != test.expected {
+				t.Errorf("Expected: %q\nGot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenderHalfBlock(t *testing.T) {
+	frame := ColorFrame{
+		Frame:   Frame{{'▄'}},
+		FG:      [][]Color{{{0, 0, 0}}},
+		BG:      [][]Color{{{255, 255, 255}}},
+		Charset: HalfBlock,
+	}
+
+	tests := []struct {
+		mode     ColorMode
+		expected string
+	}{
+		{Mono, "▄"},
+		{TrueColor, "\033[38;2;0;0;0m\033[48;2;255;255;255m▀\033[0m"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			if got := frame.render(0, test.mode); got != test.expected {
+				t.Errorf("Expected: %q\nGot: %q", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package video
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// unchanged stands in the glyphs of a delta frame for the cells that are
+// the same as in its reference frame. No frame draws the NUL rune.
+const unchanged rune = 0
+
+// FrameEncoder encodes the frames of one sender: a keyframe every
+// interval, when asked for one or when the frame cannot be compared to
+// the previous one, and delta frames from the previous frame in between.
+type FrameEncoder struct {
+	interval     time.Duration
+	prev         ColorFrame
+	prevId       uint32
+	prevMode     ColorMode
+	lastKeyframe time.Time
+	keyframe     bool
+}
+
+func NewFrameEncoder(interval time.Duration) *FrameEncoder {
+	return &FrameEncoder{interval: interval, keyframe: true}
+}
+
+// RequestKeyframe makes the next frame a keyframe.
+func (e *FrameEncoder) RequestKeyframe() {
+	e.keyframe = true
+}
+
+// Encode encodes f, frame id of the sender, for mode.
+func (e *FrameEncoder) Encode(f ColorFrame, id uint32, mode ColorMode) []byte {
+	var encoded []byte
+	if !e.keyframe && mode == e.prevMode && time.Since(e.lastKeyframe) < e.interval {
+		encoded = encodeDelta(f, e.prev, e.prevId, mode)
+	}
+	if encoded == nil {
+		encoded = EncodeFrame(f, mode)
+		e.keyframe = false
+		e.lastKeyframe = time.Now()
+	}
+	e.prev, e.prevId, e.prevMode = f, id, mode
+	return encoded
+}
+
+// encodeDelta encodes the cells of f that differ from ref, frame id
+// refId, as
+//
+//	[0][version][2][reference frame id uint32][mode][charset]
+//	[width uvarint][height uvarint][glyphs][color runs]
+//
+// the glyphs being those of EncodeFrame with unchanged in every cell that
+// is the same and the color runs only holding the colors of the cells
+// that changed. It returns nil when the frames cannot be compared or so
+// much changed that a keyframe is better.
+func encodeDelta(f, ref ColorFrame, refId uint32, mode ColorMode) []byte {
+	if !comparable(f, ref, mode) {
+		return nil
+	}
+
+	rows, cols := len(f.Frame), len(f.Frame[0])
+	glyphs := make(Frame, rows)
+	var fg, bg []Color
+	for rowIdx := range rows {
+		glyphs[rowIdx] = make([]rune, cols)
+		for colIdx := range cols {
+			same := f.Frame[rowIdx][colIdx] == ref.Frame[rowIdx][colIdx]
+			if mode != Mono {
+				same = same && sameColor(f.FG[rowIdx][colIdx], ref.FG[rowIdx][colIdx], mode)
+				if f.BG != nil {
+					same = same && sameColor(f.BG[rowIdx][colIdx], ref.BG[rowIdx][colIdx], mode)
+				}
+			}
+			if same {
+				glyphs[rowIdx][colIdx] = unchanged
+				continue
+			}
+
+			glyphs[rowIdx][colIdx] = f.Frame[rowIdx][colIdx]
+			if mode != Mono {
+				fg = append(fg, f.FG[rowIdx][colIdx])
+				if f.BG != nil {
+					bg = append(bg, f.BG[rowIdx][colIdx])
+				}
+			}
+		}
+	}
+	if changed := countChanged(glyphs); changed > rows*cols/2 {
+		return nil
+	}
+
+	output := []byte{extendedMarker, frameVersion, deltaEncoding}
+	output = binary.LittleEndian.AppendUint32(output, refId)
+	output = append(output, byte(mode), byte(f.Charset))
+	output = binary.AppendUvarint(output, uint64(cols))
+	output = binary.AppendUvarint(output, uint64(rows))
+	output = append(output, glyphs.encodeGlyphs()...)
+	if len(fg) > 0 {
+		output = append(output, encodeColors([][]Color{fg}, mode)...)
+	}
+	if len(bg) > 0 {
+		output = append(output, encodeColors([][]Color{bg}, mode)...)
+	}
+	return output
+}
+
+// comparable reports whether a delta from ref can describe f in mode.
+func comparable(f, ref ColorFrame, mode ColorMode) bool {
+	if len(f.Frame) == 0 || len(f.Frame) != len(ref.Frame) ||
+		len(f.Frame[0]) != len(ref.Frame[0]) || f.Charset != ref.Charset {
+		return false
+	}
+	if mode == Mono {
+		return true
+	}
+	return f.FG != nil && ref.FG != nil && (f.BG == nil) == (ref.BG == nil)
+}
+
+// sameColor reports whether a and b look the same in mode.
+func sameColor(a, b Color, mode ColorMode) bool {
+	if mode == Color256 {
+		return To256(a) == To256(b)
+	}
+	return a == b
+}
+
+func countChanged(glyphs Frame) int {
+	var changed int
+	for _, row := range glyphs {
+		for _, char := range row {
+			if char != unchanged {
+				changed++
+			}
+		}
+	}
+	return changed
+}
+
+// deltaReference returns the reference frame id of a delta frame, and
+// false for any other encoding. Version 1 deltas start like unversioned
+// TrueColor frames, so those are tried first.
+func deltaReference(data []byte) (uint32, bool) {
+	if len(data) < 2 || data[0] != extendedMarker {
+		return 0, false
+	}
+	switch data[1] {
+	case frameVersion:
+		if len(data) < 7 || data[2] != deltaEncoding {
+			return 0, false
+		}
+		return binary.LittleEndian.Uint32(data[3:7]), true
+	case deltaEncoding:
+		if _, err := decodeUnversioned(data); len(data) < 6 || err == nil {
+			return 0, false
+		}
+		return binary.LittleEndian.Uint32(data[2:6]), true
+	}
+	return 0, false
+}
+
+// decodeDelta applies a delta frame to ref, the frame it was made from,
+// leaving ref as it was.
+func decodeDelta(data []byte, ref ColorFrame) (ColorFrame, error) {
+	// version 1 deltas had no version byte
+	if data[1] == frameVersion {
+		data = data[7:]
+	} else {
+		data = data[6:]
+	}
+	h, data, err := decodeFrameHeader(data)
+	if err != nil {
+		return ColorFrame{}, err
+	}
+	if h.charset != ref.Charset || h.height != len(ref.Frame) || h.width != len(ref.Frame[0]) {
+		return ColorFrame{}, errors.New("delta frame does not match its reference")
+	}
+	if h.mode != Mono && ref.FG == nil {
+		return ColorFrame{}, errors.New("delta frame colors without reference colors")
+	}
+
+	glyphs, data, err := decodeGlyphs(data, h.width, h.height)
+	if err != nil {
+		return ColorFrame{}, err
+	}
+
+	var fg, bg []Color
+	if changed := countChanged(glyphs); changed > 0 && h.mode != Mono {
+		var colors [][]Color
+		colors, data, err = decodeColors(data, h.mode, 1, changed)
+		if err != nil {
+			return ColorFrame{}, err
+		}
+		fg = colors[0]
+		if ref.BG != nil {
+			colors, data, err = decodeColors(data, h.mode, 1, changed)
+			if err != nil {
+				return ColorFrame{}, err
+			}
+			bg = colors[0]
+		}
+	}
+	if len(data) != 0 {
+		return ColorFrame{}, errors.New("delta frame colors do not match glyphs")
+	}
+
+	frame := ColorFrame{Frame: make(Frame, h.height), Charset: ref.Charset}
+	if h.mode != Mono {
+		frame.FG = make([][]Color, h.height)
+		if ref.BG != nil {
+			frame.BG = make([][]Color, h.height)
+		}
+	}
+	var next int
+	for rowIdx := range h.height {
+		frame.Frame[rowIdx] = append([]rune(nil), ref.Frame[rowIdx]...)
+		if frame.FG != nil {
+			frame.FG[rowIdx] = append([]Color(nil), ref.FG[rowIdx]...)
+		}
+		if frame.BG != nil {
+			frame.BG[rowIdx] = append([]Color(nil), ref.BG[rowIdx]...)
+		}
+		for colIdx, char := range glyphs[rowIdx] {
+			if char == unchanged {
+				continue
+			}
+			frame.Frame[rowIdx][colIdx] = char
+			if frame.FG != nil {
+				frame.FG[rowIdx][colIdx] = fg[next]
+			}
+			if frame.BG != nil {
+				frame.BG[rowIdx][colIdx] = bg[next]
+			}
+			next++
+		}
+	}
+	return frame, nil
+}
@@ -0,0 +1,179 @@
+package video
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sendFrame chunks an encoded frame the way cmd/bro does and feeds the
+// chunks to fcc, returning the frame it put together.
+func sendFrame(fcc *FrameChunkCatcher, encoded []byte, id uint32) ColorFrame {
+	var caught ColorFrame
+	for _, c := range ChunkFrameData(encoded, 16, id, time.Now()) {
+		if f, _ := fcc.CatchColor(c.Encode()); f.Frame != nil {
+			caught = f
+		}
+	}
+	return caught
+}
+
+func TestDeltaFrames(t *testing.T) {
+	red, blue := Color{255, 0, 0}, Color{0, 0, 255}
+	frames := []ColorFrame{
+		{
+			Frame: Frame{{'#', '#', '.', '.'}, {'%', '%', '%', '@'}},
+			FG:    [][]Color{{red, red, red, red}, {blue, blue, blue, blue}},
+		},
+		{
+			// one glyph changed
+			Frame: Frame{{'#', '#', '.', '.'}, {'%', '%', '@', '@'}},
+			FG:    [][]Color{{red, red, red, red}, {blue, blue, blue, blue}},
+		},
+		{
+			// one color changed
+			Frame: Frame{{'#', '#', '.', '.'}, {'%', '%', '@', '@'}},
+			FG:    [][]Color{{red, blue, red, red}, {blue, blue, blue, blue}},
+		},
+	}
+
+	for _, mode := range []ColorMode{Mono, Color256, TrueColor} {
+		t.Run(mode.String(), func(t *testing.T) {
+			encoder := NewFrameEncoder(time.Minute)
+			fcc := NewFrameCatcher()
+
+			for id, frame := range frames {
+				encoded := encoder.Encode(frame, uint32(id), mode)
+				if _, ok := deltaReference(encoded); ok != (id > 0) {
+					t.Errorf("frame %d: expected delta %v", id, id > 0)
+				}
+
+				expected := frame
+				if mode == Mono {
+					expected = ColorFrame{Frame: frame.Frame}
+				}
+				if got := sendFrame(fcc, encoded, uint32(id)); !reflect.DeepEqual(got, expected) {
+					t.Errorf("frame %d\nExpected:\n%v\nGot:\n%v", id, expected, got)
+				}
+			}
+		})
+	}
+
+	t.Run("half blocks", func(t *testing.T) {
+		encoder := NewFrameEncoder(time.Minute)
+		fcc := NewFrameCatcher()
+
+		first := ColorFrame{
+			Frame:   Frame{{'▀', '▀'}},
+			FG:      [][]Color{{red, red}},
+			BG:      [][]Color{{blue, blue}},
+			Charset: HalfBlock,
+		}
+		second := ColorFrame{
+			Frame:   Frame{{'▀', '▀'}},
+			FG:      [][]Color{{red, red}},
+			BG:      [][]Color{{blue, red}},
+			Charset: HalfBlock,
+		}
+
+		sendFrame(fcc, encoder.Encode(first, 0, TrueColor), 0)
+		encoded := encoder.Encode(second, 1, TrueColor)
+		if _, ok := deltaReference(encoded); !ok {
+			t.Fatalf("expected a delta frame")
+		}
+		if got := sendFrame(fcc, encoded, 1); !reflect.DeepEqual(got, second) {
+			t.Errorf("Expected:\n%v\nGot:\n%v", second, got)
+		}
+	})
+}
+
+func TestOlderDeltas(t *testing.T) {
+	red, blue := Color{255, 0, 0}, Color{0, 0, 255}
+	frames := []ColorFrame{
+		{
+			Frame: Frame{{'#', '#', '.', '.'}, {'%', '%', '%', '@'}},
+			FG:    [][]Color{{red, red, red, red}, {blue, blue, blue, blue}},
+		},
+		{
+			Frame: Frame{{'#', '#', '.', '.'}, {'%', '%', '@', '@'}},
+			FG:    [][]Color{{red, red, red, red}, {blue, blue, blue, blue}},
+		},
+	}
+
+	// version 1 frames are these without the version byte
+	encoder := NewFrameEncoder(time.Minute)
+	fcc := NewFrameCatcher()
+	for id, frame := range frames {
+		encoded := encoder.Encode(frame, uint32(id), TrueColor)
+		old := append([]byte{extendedMarker}, encoded[2:]...)
+		if got := sendFrame(fcc, old, uint32(id)); !reflect.DeepEqual(got, frame) {
+			t.Errorf("frame %d\nExpected:\n%v\nGot:\n%v", id, frame, got)
+		}
+	}
+
+	// an unversioned TrueColor frame starts like a version 1 delta
+	if _, ok := deltaReference(unversionedHalfBlock); ok {
+		t.Errorf("expected an unversioned frame not to be taken for a delta")
+	}
+	if got := sendFrame(fcc, unversionedHalfBlock, uint32(len(frames))); got.Charset != HalfBlock {
+		t.Errorf("expected the unversioned frame, got %v", got)
+	}
+}
+
+func TestKeyframes(t *testing.T) {
+	frame := func(c rune) ColorFrame {
+		return ColorFrame{Frame: Frame{{'#', '#', '#', c}}}
+	}
+
+	t.Run("lost reference asks for a keyframe", func(t *testing.T) {
+		encoder := NewFrameEncoder(time.Minute)
+		fcc := NewFrameCatcher()
+
+		sendFrame(fcc, encoder.Encode(frame('a'), 0, Mono), 0)
+		// frame 1 never arrives
+		encoder.Encode(frame('b'), 1, Mono)
+		if got := sendFrame(fcc, encoder.Encode(frame('c'), 2, Mono), 2); got.Frame != nil {
+			t.Errorf("expected the delta to be dropped, got %v", got)
+		}
+		if !fcc.NeedsKeyframe() {
+			t.Fatalf("expected a keyframe to be needed")
+		}
+
+		encoder.RequestKeyframe()
+		encoded := encoder.Encode(frame('d'), 3, Mono)
+		if _, ok := deltaReference(encoded); ok {
+			t.Fatalf("expected a keyframe after the request")
+		}
+		if got := sendFrame(fcc, encoded, 3); !reflect.DeepEqual(got.Frame, frame('d').Frame) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", frame('d').Frame, got.Frame)
+		}
+		if fcc.NeedsKeyframe() {
+			t.Errorf("expected the keyframe to satisfy the catcher")
+		}
+	})
+
+	t.Run("every interval", func(t *testing.T) {
+		encoder := NewFrameEncoder(0)
+		encoder.Encode(frame('a'), 0, Mono)
+		if _, ok := deltaReference(encoder.Encode(frame('b'), 1, Mono)); ok {
+			t.Errorf("expected a keyframe once the interval passed")
+		}
+	})
+
+	t.Run("size change", func(t *testing.T) {
+		encoder := NewFrameEncoder(time.Minute)
+		encoder.Encode(frame('a'), 0, Mono)
+		wide := ColorFrame{Frame: Frame{{'#', '#', '#', '#', '#'}}}
+		if _, ok := deltaReference(encoder.Encode(wide, 1, Mono)); ok {
+			t.Errorf("expected a keyframe for a frame of another size")
+		}
+	})
+
+	t.Run("stale frames are dropped", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		sendFrame(fcc, EncodeFrame(frame('b'), Mono), 5)
+		if got := sendFrame(fcc, EncodeFrame(frame('a'), Mono), 4); got.Frame != nil {
+			t.Errorf("expected frame 4 to be dropped after frame 5, got %v", got)
+		}
+	})
+}
@@ -1,9 +1,13 @@
 package video
 
 import (
+	"encoding/binary"
 	"math/rand"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEncoding(t *testing.T) {
@@ -24,9 +28,10 @@ func TestEncoding(t *testing.T) {
 
 	t.Log("> passed rle check")
 
-	chunks := ChunkFrameData(rle, 2, 1)
+	chunks := ChunkFrameData(rle, 2, 1, time.Now())
 
-	if len(chunks) != 7 {
+	// 13 bytes of rle behind the 8 byte timestamp
+	if len(chunks) != 11 {
 		t.FailNow()
 	}
 
@@ -39,13 +44,13 @@ func TestEncoding(t *testing.T) {
 	var outerFrame Frame
 	for _, c := range chunks {
 		data := c.Encode()
-		f := fcc.Catch(data)
+		f, _ := fcc.Catch(data)
 		if f != nil {
 			outerFrame = f
 		}
 	}
 
-	if len(fcc) != 0 {
+	if len(fcc.chunks) != 0 {
 		t.FailNow()
 	}
 
@@ -90,7 +95,7 @@ func TestEncodingAndDecoding(t *testing.T) {
 			rle := tt.frame.RunLengthEncode()
 
 			// Decode the RLE into chunks
-			chunks := ChunkFrameData(rle, 2, 1) // Assuming chunk size of 6 bytes
+			chunks := ChunkFrameData(rle, 2, 1, time.Now()) // Assuming chunk size of 6 bytes
 
 			// Shuffle chunks to simulate random transmission order
 			rand.Shuffle(len(chunks), func(i, j int) {
@@ -104,7 +109,7 @@ func TestEncodingAndDecoding(t *testing.T) {
 			var reconstructed Frame
 			for _, c := range chunks {
 				data := c.Encode()
-				f := fcc.Catch(data)
+				f, _ := fcc.Catch(data)
 				if f != nil {
 					reconstructed = f
 				}
@@ -150,6 +155,24 @@ func TestRunLengthEncodeAndDecode(t *testing.T) {
 				{'*', '*', '*', '*'},
 			},
 		},
+		{
+			name: "Braille",
+			frame: Frame{
+				{'⣿', '⣿', '⠁', brailleBase},
+				{'⡀', '⡀', '⡀', '⣿'},
+			},
+		},
+		{
+			name: "Half blocks",
+			frame: Frame{
+				{upperHalf, '▄', '█', ' '},
+				{'█', '█', upperHalf, upperHalf},
+			},
+		},
+		{
+			name:  "Wider than 255 columns",
+			frame: Frame{[]rune(strings.Repeat("#.", 200))},
+		},
 		// Add more test cases as needed
 	}
 
@@ -231,3 +254,369 @@ func TestFrameChunkEncodingAndDecoding(t *testing.T) {
 		}
 	})
 }
+
+func TestEncodeFrame(t *testing.T) {
+	frame := ColorFrame{
+		Frame: Frame{{'#', '#', '.', '.'}, {'%', '%', '%', '@'}},
+		FG: [][]Color{
+			{{255, 0, 0}, {255, 0, 0}, {0, 0, 255}, {0, 0, 255}},
+			{{0, 135, 0}, {0, 135, 0}, {0, 135, 0}, {238, 238, 238}},
+		},
+	}
+
+	t.Run("mono keeps the original encoding", func(t *testing.T) {
+		encoded := EncodeFrame(frame, Mono)
+		if !reflect.DeepEqual(encoded, frame.Frame.RunLengthEncode()) {
+			t.Errorf("Expected: %v\nGot: %v", frame.Frame.RunLengthEncode(), encoded)
+		}
+		decoded, err := DecodeFrame(encoded)
+		if err != nil {
+			t.Fatalf("error decoding: %v", err)
+		}
+		if !reflect.DeepEqual(decoded.Frame, frame.Frame) || decoded.FG != nil {
+			t.Errorf("Expected:\n%s\nGot:\n%v", frame.Frame, decoded)
+		}
+	})
+
+	// every color above is in the 256 color palette, so both modes are
+	// lossless
+	for _, mode := range []ColorMode{Color256, TrueColor} {
+		t.Run(mode.String(), func(t *testing.T) {
+			decoded, err := DecodeFrame(EncodeFrame(frame, mode))
+			if err != nil {
+				t.Fatalf("error decoding: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, frame) {
+				t.Errorf("Expected:\n%v\nGot:\n%v", frame, decoded)
+			}
+		})
+	}
+
+	t.Run("colors not matching glyphs", func(t *testing.T) {
+		encoded := EncodeFrame(frame, TrueColor)
+		if _, err := DecodeFrame(encoded[:len(encoded)-4]); err == nil {
+			t.Errorf("expected an error for missing colors")
+		}
+	})
+}
+
+func TestEncodeHalfBlockFrame(t *testing.T) {
+	white, red := Color{255, 255, 255}, Color{255, 0, 0}
+	frame := ColorFrame{
+		Frame:   Frame{{'▀', '▀', '█'}, {' ', '▄', '▄'}},
+		FG:      [][]Color{{white, white, white}, {red, red, white}},
+		BG:      [][]Color{{red, red, white}, {red, white, white}},
+		Charset: HalfBlock,
+	}
+
+	for _, mode := range []ColorMode{Color256, TrueColor} {
+		t.Run(mode.String(), func(t *testing.T) {
+			decoded, err := DecodeFrame(EncodeFrame(frame, mode))
+			if err != nil {
+				t.Fatalf("error decoding: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, frame) {
+				t.Errorf("Expected:\n%v\nGot:\n%v", frame, decoded)
+			}
+		})
+	}
+
+	t.Run("mono keeps the glyphs", func(t *testing.T) {
+		decoded, err := DecodeFrame(EncodeFrame(frame, Mono))
+		if err != nil {
+			t.Fatalf("error decoding: %v", err)
+		}
+		expected := ColorFrame{Frame: frame.Frame, Charset: HalfBlock}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("Expected:\n%v\nGot:\n%v", expected, decoded)
+		}
+	})
+}
+
+func TestEncodeWideFrame(t *testing.T) {
+	frame := Frame{make([]rune, 300), make([]rune, 300)}
+	for colIdx := range 300 {
+		frame[0][colIdx] = []rune("ab€😀")[colIdx%4]
+		frame[1][colIdx] = 'z'
+	}
+
+	t.Run("keeps every rune", func(t *testing.T) {
+		encoded := EncodeFrame(ColorFrame{Frame: frame}, Mono)
+		if encoded[0] != extendedMarker {
+			t.Fatalf("expected the extended encoding, got first byte %d", encoded[0])
+		}
+		decoded, err := DecodeFrame(encoded)
+		if err != nil {
+			t.Fatalf("error decoding: %v", err)
+		}
+		if !reflect.DeepEqual(decoded.Frame, frame) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", frame, decoded.Frame)
+		}
+	})
+
+	t.Run("old format for frames that fit", func(t *testing.T) {
+		small := Frame{{'a', 'b'}}
+		encoded := EncodeFrame(ColorFrame{Frame: small}, Mono)
+		if !reflect.DeepEqual(encoded, small.RunLengthEncode()) {
+			t.Errorf("Expected: %v\nGot: %v", small.RunLengthEncode(), encoded)
+		}
+	})
+
+	t.Run("bad glyph runs", func(t *testing.T) {
+		encoded := EncodeFrame(ColorFrame{Frame: frame}, Mono)
+		if _, err := DecodeFrame(encoded[:len(encoded)-2]); err == nil {
+			t.Errorf("expected an error for truncated glyphs")
+		}
+	})
+
+	t.Run("too big", func(t *testing.T) {
+		header := []byte{extendedMarker, frameVersion, keyframeEncoding, byte(Mono), byte(ASCII)}
+		header = binary.AppendUvarint(header, maxFrameWidth+1)
+		header = binary.AppendUvarint(header, 1)
+		if _, err := DecodeFrame(append(header, 0)); err == nil {
+			t.Errorf("expected an error for a frame wider than %d", maxFrameWidth)
+		}
+	})
+
+	t.Run("short frame claiming to be big", func(t *testing.T) {
+		// one glyph of a 4096x3072 frame
+		encoded := []byte{extendedMarker, frameVersion, keyframeEncoding, byte(TrueColor), byte(ASCII)}
+		encoded = binary.AppendUvarint(encoded, maxFrameWidth)
+		encoded = binary.AppendUvarint(encoded, maxFrameCells/maxFrameWidth)
+		encoded = append(encoded, 1, 'a', 1, 0)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if _, err := DecodeFrame(encoded); err == nil {
+			t.Fatalf("expected an error for truncated glyphs")
+		}
+		runtime.ReadMemStats(&after)
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("expected little allocated for a frame of %d bytes, got %d", len(encoded), allocated)
+		}
+	})
+}
+
+// unversionedHalfBlock is a 2x1 HalfBlock frame in TrueColor as peers
+// wrote it before frames had a version, its glyphs sent as their index
+// in halfBlocks.
+var unversionedHalfBlock = []byte{
+	extendedMarker, byte(TrueColor), byte(HalfBlock), 5, 2, 1, 1, 1, 3,
+	1, 255, 0, 0, 1, 0, 0, 255,
+	2, 0, 0, 0,
+}
+
+func TestOlderFrames(t *testing.T) {
+	red, blue, black := Color{255, 0, 0}, Color{0, 0, 255}, Color{}
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected ColorFrame
+	}{
+		{
+			name: "unversioned half blocks",
+			data: unversionedHalfBlock,
+			expected: ColorFrame{
+				Frame:   Frame{{upperHalf, '█'}},
+				FG:      [][]Color{{red, blue}},
+				BG:      [][]Color{{black, black}},
+				Charset: HalfBlock,
+			},
+		},
+		{
+			name: "unversioned braille in 256 colors",
+			data: []byte{extendedMarker, byte(Color256), byte(Braille), 5, 2, 1, 0xff, 1, 0x01, 2, 196},
+			expected: ColorFrame{
+				Frame:   Frame{{'⣿', '⠁'}},
+				FG:      [][]Color{{From256(196), From256(196)}},
+				Charset: Braille,
+			},
+		},
+		{
+			name:     "unversioned mono braille",
+			data:     []byte{extendedMarker, byte(Mono), byte(Braille), 3, 1, 1, 0x01},
+			expected: ColorFrame{Frame: Frame{{'⠁'}}, Charset: Braille},
+		},
+		{
+			name:     "version 1 keyframe",
+			data:     []byte{extendedMarker, keyframeEncoding, byte(Mono), byte(ASCII), 2, 1, 2, 'a', 'b', 1, 0, 1, 1},
+			expected: ColorFrame{Frame: Frame{{'a', 'b'}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoded, err := DecodeFrame(tc.data)
+			if err != nil {
+				t.Fatalf("error decoding: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tc.expected) {
+				t.Errorf("Expected:\n%v\nGot:\n%v", tc.expected, decoded)
+			}
+		})
+	}
+
+	t.Run("version byte", func(t *testing.T) {
+		encoded := EncodeFrame(ColorFrame{Frame: Frame{{'⠁'}}, Charset: Braille}, Mono)
+		if encoded[1] != frameVersion || encoded[2] != keyframeEncoding {
+			t.Errorf("expected version %d keyframe, got %v", frameVersion, encoded[:3])
+		}
+	})
+}
+
+func TestManyChunks(t *testing.T) {
+	frame := Frame{[]rune("more than two hundred and fifty five chunks")}
+	// empty runs pad the encoding to 300 bytes
+	encoded := frame.RunLengthEncode()
+	encoded = append(encoded, make([]byte, 300-len(encoded))...)
+
+	chunks := ChunkFrameData(encoded, 1, 7, time.Now())
+	if len(chunks) != 308 {
+		t.Fatalf("expected 308 chunks, got %d", len(chunks))
+	}
+
+	fcc := NewFrameCatcher()
+	var caught Frame
+	for _, c := range chunks {
+		var decoded FrameChunk
+		if err := decoded.Decode(c.Encode()); err != nil {
+			t.Fatalf("error decoding chunk: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, c) {
+			t.Fatalf("Expected: %+v\nGot: %+v", c, decoded)
+		}
+		if f, _ := fcc.Catch(c.Encode()); f != nil {
+			caught = f
+		}
+	}
+
+	if !reflect.DeepEqual(caught, frame) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", frame, caught)
+	}
+}
+
+func TestFrameChunkCatcher(t *testing.T) {
+	frame := Frame{[]rune("a frame split into several chunks")}
+	chunks := func(id uint32) []FrameChunk {
+		return ChunkFrameData(frame.RunLengthEncode(), 8, id, time.Now())
+	}
+
+	t.Run("duplicates do not fill gaps", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		cs := chunks(1)
+		for _, c := range cs[:len(cs)-1] {
+			fcc.Catch(c.Encode())
+		}
+		if f, _ := fcc.Catch(cs[0].Encode()); f != nil {
+			t.Fatalf("expected no frame from a duplicate chunk")
+		}
+		if f, _ := fcc.Catch(cs[len(cs)-1].Encode()); f == nil {
+			t.Fatalf("expected the frame once the last chunk arrived")
+		}
+		if stats := fcc.Stats(); stats.Duplicates != 1 || stats.Frames != 1 {
+			t.Errorf("expected 1 duplicate and 1 frame, got %+v", stats)
+		}
+	})
+
+	t.Run("malformed chunks", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		cs := chunks(1)
+		fcc.Catch(cs[0].Encode())
+		other := cs[1]
+		other.TotalChunks++
+		fcc.Catch(other.Encode())
+		fcc.Catch([]byte{1, 2})
+		if stats := fcc.Stats(); stats.Malformed != 2 || stats.Duplicates != 0 {
+			t.Errorf("expected 2 malformed chunks and no duplicates, got %+v", stats)
+		}
+
+		var caught Frame
+		for _, c := range cs[1:] {
+			if f, _ := fcc.Catch(c.Encode()); f != nil {
+				caught = f
+			}
+		}
+		if !reflect.DeepEqual(caught, frame) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", frame, caught)
+		}
+	})
+
+	t.Run("newer frame evicts incomplete ones", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		fcc.Catch(chunks(1)[0].Encode())
+		for _, c := range chunks(2) {
+			fcc.Catch(c.Encode())
+		}
+		if len(fcc.chunks) != 0 || fcc.buffered != 0 {
+			t.Errorf("expected nothing held, got %d frames of %d bytes", len(fcc.chunks), fcc.buffered)
+		}
+		if stats := fcc.Stats(); stats.Incomplete != 1 {
+			t.Errorf("expected 1 incomplete frame, got %+v", stats)
+		}
+
+		// late chunks of the evicted frame are not held again
+		fcc.Catch(chunks(1)[1].Encode())
+		if len(fcc.chunks) != 0 {
+			t.Errorf("expected late chunks to be ignored")
+		}
+	})
+
+	t.Run("window", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		fcc.window = time.Millisecond
+		fcc.Catch(chunks(1)[0].Encode())
+		time.Sleep(5 * time.Millisecond)
+		fcc.Catch(chunks(2)[0].Encode())
+
+		if _, ok := fcc.chunks[1]; ok {
+			t.Errorf("expected frame 1 to be evicted after the window")
+		}
+		if stats := fcc.Stats(); stats.Incomplete != 1 {
+			t.Errorf("expected 1 incomplete frame, got %+v", stats)
+		}
+
+		// with no frame shown yet, late chunks of the frame given up on
+		// are not held again to be counted lost a second time
+		fcc.window = time.Minute
+		fcc.Loss()
+		fcc.Catch(chunks(1)[1].Encode())
+		if _, ok := fcc.chunks[1]; ok {
+			t.Errorf("expected late chunks of frame 1 to be ignored")
+		}
+	})
+
+	t.Run("byte cap", func(t *testing.T) {
+		// 8 bytes a chunk and a slot for each of the frame's chunks, so
+		// only the newest two frames fit
+		held := 8 + len(chunks(1))*chunkSlot
+		fcc := NewFrameCatcher()
+		fcc.maxBytes = 2*held + held/2
+		for id := uint32(1); id <= 4; id++ {
+			fcc.Catch(chunks(id)[0].Encode())
+		}
+
+		if fcc.buffered > fcc.maxBytes || len(fcc.chunks) != 2 {
+			t.Errorf("expected 2 frames within the cap, got %d frames of %d bytes", len(fcc.chunks), fcc.buffered)
+		}
+		if _, ok := fcc.chunks[4]; !ok {
+			t.Errorf("expected the newest frame to be kept")
+		}
+		if stats := fcc.Stats(); stats.Incomplete != 2 {
+			t.Errorf("expected 2 incomplete frames, got %+v", stats)
+		}
+	})
+
+	t.Run("frames claiming many chunks", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		for id := uint32(1); id <= 16; id++ {
+			c := FrameChunk{FrameId: id, TotalChunks: maxChunks, Data: []byte{1}}
+			fcc.Catch(c.Encode())
+		}
+		if fcc.buffered > fcc.maxBytes {
+			t.Errorf("expected the chunks held within %d bytes, got %d", fcc.maxBytes, fcc.buffered)
+		}
+		if want := 1 + maxChunks*chunkSlot; len(fcc.chunks) != fcc.maxBytes/want {
+			t.Errorf("Expected: %d frames held\nGot: %d", fcc.maxBytes/want, len(fcc.chunks))
+		}
+	})
+}
@@ -4,12 +4,25 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"sort"
-	"strings"
 	"time"
 )
 
+// RunLengthEncode encodes a monochrome frame. Frames of at most 255
+// columns of single byte glyphs keep the original encoding of a column
+// count then [count][glyph] byte pairs; others, like braille or half
+// block frames, get the extended encoding of EncodeFrame, which keeps
+// every rune.
 func (f Frame) RunLengthEncode() []byte {
+	if !f.fitsRunLength() {
+		return EncodeFrame(ColorFrame{Frame: f}, Mono)
+	}
+	return f.runLengthEncode()
+}
+
+// runLengthEncode is the original encoding, for frames that fit it.
+func (f Frame) runLengthEncode() []byte {
 
 	var tally uint8
 	var prevChar rune
@@ -54,22 +67,44 @@ func (f Frame) RunLengthEncode() []byte {
 	return output
 }
 
+// RunLengthDecode decodes what RunLengthEncode wrote, an empty frame
+// for data it cannot decode.
 func RunLengthDecode(data []byte) Frame {
 
 	if len(data) == 0 {
 		return Frame{}
 	}
+	if data[0] == extendedMarker {
+		frame, err := DecodeFrame(data)
+		if err != nil {
+			return Frame{}
+		}
+		return frame.Frame
+	}
+
+	return runLengthDecode(data, ASCII)
+}
+
+// runLengthDecode is RunLengthDecode of the original encoding, with
+// every glyph sent as its charset code.
+func runLengthDecode(data []byte, charset Charset) Frame {
+
+	if len(data) == 0 || data[0] == 0 {
+		return Frame{}
+	}
 
 	cols := int(data[0])
 
 	// fmt.Printf("read columns: %d\n", cols)
 	data = data[1:]
 
-	s := ""
-	for i := 0; i < len(data); i += 2 {
+	var s []rune
+	for i := 0; i+1 < len(data); i += 2 {
 		n := data[i]
-		char := data[i+1]
-		s += strings.Repeat(string(char), int(n))
+		char := charset.glyph(data[i+1])
+		for range n {
+			s = append(s, char)
+		}
 	}
 
 	var output Frame
@@ -84,19 +119,446 @@ func RunLengthDecode(data []byte) Frame {
 	return output
 }
 
+// fitsRunLength reports whether RunLengthEncode can hold f, which needs
+// at most 255 columns and glyphs of a single byte.
+func (f Frame) fitsRunLength() bool {
+	if len(f) > 0 && len(f[0]) > 255 {
+		return false
+	}
+	for _, row := range f {
+		for _, char := range row {
+			if char <= 0 || char > 255 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// extendedMarker starts every frame encoding other than the original
+// monochrome run length encoding, whose first byte is the non-zero
+// column count.
+const extendedMarker = 0
+
+// frameVersion follows extendedMarker in the frames EncodeFrame and
+// FrameEncoder write, then the kind of frame. Older peers put other
+// bytes there: the color mode, 0 to 2, of unversioned frames, then the
+// kind of version 1 frames, which had no version byte.
+const frameVersion = 3
+
+// The kinds of frames, telling whole frames from deltas.
+const (
+	keyframeEncoding = 1
+	deltaEncoding    = 2
+)
+
+// EncodeFrame encodes f for the wire with its colors reduced to mode.
+// Monochrome ASCII frames that fit keep the RunLengthEncode format older
+// peers read. All others are
+//
+//	[0][version][1][mode][charset][width uvarint][height uvarint]
+//	[palette length uvarint][palette runes uvarint...]
+//	[glyph runs: count uvarint, palette index uvarint...][color runs]
+//
+// The color runs hold the foreground colors followed by the background
+// colors of HalfBlock frames, and are left out in Mono mode.
+func EncodeFrame(f ColorFrame, mode ColorMode) []byte {
+	if f.FG == nil {
+		mode = Mono
+	}
+	if mode == Mono && f.Charset == ASCII && f.Frame.fitsRunLength() {
+		return f.Frame.runLengthEncode()
+	}
+	if len(f.Frame) == 0 || len(f.Frame[0]) == 0 {
+		return nil
+	}
+
+	output := []byte{extendedMarker, frameVersion, keyframeEncoding, byte(mode), byte(f.Charset)}
+	output = binary.AppendUvarint(output, uint64(len(f.Frame[0])))
+	output = binary.AppendUvarint(output, uint64(len(f.Frame)))
+	output = append(output, f.Frame.encodeGlyphs()...)
+	if mode == Mono {
+		return output
+	}
+	output = append(output, encodeColors(f.FG, mode)...)
+	if f.BG != nil {
+		output = append(output, encodeColors(f.BG, mode)...)
+	}
+	return output
+}
+
+// encodeGlyphs writes the palette of the distinct glyphs of f in order
+// of appearance, then the glyphs as runs of palette indexes.
+func (f Frame) encodeGlyphs() []byte {
+	palette := make(map[rune]uint64)
+	var runes []rune
+	for _, row := range f {
+		for _, char := range row {
+			if _, ok := palette[char]; !ok {
+				palette[char] = uint64(len(runes))
+				runes = append(runes, char)
+			}
+		}
+	}
+
+	output := binary.AppendUvarint(nil, uint64(len(runes)))
+	for _, char := range runes {
+		output = binary.AppendUvarint(output, uint64(char))
+	}
+
+	var tally uint64
+	var prev rune
+	for _, row := range f {
+		for _, char := range row {
+			if tally > 0 && char != prev {
+				output = binary.AppendUvarint(output, tally)
+				output = binary.AppendUvarint(output, palette[prev])
+				tally = 0
+			}
+			prev = char
+			tally++
+		}
+	}
+	output = binary.AppendUvarint(output, tally)
+	return binary.AppendUvarint(output, palette[prev])
+}
+
+// encodeColors run length encodes the colors row by row as
+// [count][color] pairs, a color being one palette byte in Color256 mode
+// and three bytes of RGB in TrueColor mode.
+func encodeColors(colors [][]Color, mode ColorMode) []byte {
+	var output []byte
+	var tally uint8
+	var prev []byte
+
+	appendToOutput := func() {
+		output = append(output, tally)
+		output = append(output, prev...)
+	}
+
+	for rowIdx := range colors {
+		for _, c := range colors[rowIdx] {
+			var cur []byte
+			if mode == Color256 {
+				cur = []byte{To256(c)}
+			} else {
+				cur = []byte{c.R, c.G, c.B}
+			}
+
+			if prev != nil && string(cur) == string(prev) && tally < 255 {
+				tally++
+				continue
+			}
+			if prev != nil {
+				appendToOutput()
+			}
+			prev = cur
+			tally = 1
+		}
+	}
+
+	if tally > 0 {
+		appendToOutput()
+	}
+
+	return output
+}
+
+// maxFrameWidth and maxFrameCells bound the frames DecodeFrame accepts:
+// as wide as a bro sends, and as tall as a square picture drawn that wide.
+const (
+	maxFrameWidth = 4096
+	maxFrameCells = maxFrameWidth * maxFrameWidth * charAspect
+)
+
+// DecodeFrame decodes either encoding produced by EncodeFrame, and the
+// frames of older peers. Delta frames can only be decoded by a
+// FrameChunkCatcher holding the frame they were made from.
+func DecodeFrame(data []byte) (ColorFrame, error) {
+	if len(data) == 0 || data[0] != extendedMarker {
+		return ColorFrame{Frame: RunLengthDecode(data)}, nil
+	}
+
+	if len(data) < 2 {
+		return ColorFrame{}, errors.New("frame encoding truncated")
+	}
+	switch data[1] {
+	case frameVersion:
+	case keyframeEncoding:
+		// a version 1 keyframe, which unversioned Color256 frames never
+		// decode as, their glyph length being where the charset is
+		if frame, err := decodeKeyframe(data[2:]); err == nil {
+			return frame, nil
+		}
+		return decodeUnversioned(data)
+	default:
+		return decodeUnversioned(data)
+	}
+
+	if len(data) < 3 {
+		return ColorFrame{}, errors.New("frame encoding truncated")
+	}
+	switch data[2] {
+	case keyframeEncoding:
+		return decodeKeyframe(data[3:])
+	case deltaEncoding:
+		return ColorFrame{}, errors.New("delta frame without its reference")
+	default:
+		return ColorFrame{}, fmt.Errorf("unknown frame encoding %d", data[2])
+	}
+}
+
+// decodeKeyframe decodes the keyframe following the kind byte.
+func decodeKeyframe(data []byte) (ColorFrame, error) {
+	h, data, err := decodeFrameHeader(data)
+	if err != nil {
+		return ColorFrame{}, err
+	}
+
+	glyphs, data, err := decodeGlyphs(data, h.width, h.height)
+	if err != nil {
+		return ColorFrame{}, err
+	}
+	frame := ColorFrame{Frame: glyphs, Charset: h.charset}
+	if h.mode == Mono {
+		return frame, nil
+	}
+
+	frame.FG, data, err = decodeColors(data, h.mode, h.height, h.width)
+	if err != nil {
+		return ColorFrame{}, err
+	}
+	if h.charset == HalfBlock {
+		frame.BG, data, err = decodeColors(data, h.mode, h.height, h.width)
+		if err != nil {
+			return ColorFrame{}, err
+		}
+	}
+	if len(data) != 0 {
+		return ColorFrame{}, errors.New("frame colors do not match glyphs")
+	}
+
+	return frame, nil
+}
+
+// decodeUnversioned decodes the extended encoding from before frames
+// had a version,
+//
+//	[0][mode][charset][glyph length uvarint][glyph runs][color runs]
+//
+// the glyph runs being the original run length encoding with every
+// glyph sent as its charset code, and the color runs those of
+// EncodeFrame.
+func decodeUnversioned(data []byte) (ColorFrame, error) {
+	if len(data) < 3 {
+		return ColorFrame{}, errors.New("frame encoding truncated")
+	}
+	mode := ColorMode(data[1])
+	charset := Charset(data[2])
+	if charset > Braille {
+		return ColorFrame{}, fmt.Errorf("unknown charset %d", charset)
+	}
+	data = data[3:]
+
+	glyphLen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < glyphLen {
+		return ColorFrame{}, errors.New("frame glyphs truncated")
+	}
+	glyphs := runLengthDecode(data[n:n+int(glyphLen)], charset)
+	if len(glyphs) == 0 {
+		return ColorFrame{}, errors.New("frame without glyphs")
+	}
+	frame := ColorFrame{Frame: glyphs, Charset: charset}
+	data = data[n+int(glyphLen):]
+	if mode == Mono {
+		return frame, nil
+	}
+
+	rows, cols := len(glyphs), len(glyphs[0])
+	var err error
+	frame.FG, data, err = decodeColors(data, mode, rows, cols)
+	if err != nil {
+		return ColorFrame{}, err
+	}
+	if charset == HalfBlock {
+		frame.BG, data, err = decodeColors(data, mode, rows, cols)
+		if err != nil {
+			return ColorFrame{}, err
+		}
+	}
+	if len(data) != 0 {
+		return ColorFrame{}, errors.New("frame colors do not match glyphs")
+	}
+
+	return frame, nil
+}
+
+// frameHeader is what follows the kind byte of keyframes and the
+// reference frame id of delta frames.
+type frameHeader struct {
+	mode    ColorMode
+	charset Charset
+	width   int
+	height  int
+}
+
+// decodeFrameHeader reads [mode][charset][width uvarint][height uvarint]
+// and returns the data left after it.
+func decodeFrameHeader(data []byte) (frameHeader, []byte, error) {
+	var h frameHeader
+	if len(data) < 2 {
+		return h, nil, errors.New("frame encoding truncated")
+	}
+	h.mode = ColorMode(data[0])
+	h.charset = Charset(data[1])
+	if h.charset > Braille {
+		return h, nil, fmt.Errorf("unknown charset %d", h.charset)
+	}
+	data = data[2:]
+
+	width, n := binary.Uvarint(data)
+	if n <= 0 {
+		return h, nil, errors.New("frame width truncated")
+	}
+	data = data[n:]
+	height, n := binary.Uvarint(data)
+	if n <= 0 {
+		return h, nil, errors.New("frame height truncated")
+	}
+	data = data[n:]
+	if width == 0 || height == 0 || width > maxFrameWidth || width*height > maxFrameCells {
+		return h, nil, fmt.Errorf("bad frame size %dx%d", width, height)
+	}
+	h.width, h.height = int(width), int(height)
+
+	return h, data, nil
+}
+
+// decodeGlyphs reads what encodeGlyphs wrote for a width x height frame
+// and returns the data left after it.
+func decodeGlyphs(data []byte, width, height int) (Frame, []byte, error) {
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, errors.New("frame glyphs truncated")
+		}
+		data = data[n:]
+		return v, nil
+	}
+
+	paletteLen, err := readUvarint()
+	if err != nil {
+		return nil, nil, err
+	}
+	if paletteLen > uint64(len(data)) {
+		return nil, nil, errors.New("frame palette truncated")
+	}
+	palette := make([]rune, paletteLen)
+	for i := range palette {
+		char, err := readUvarint()
+		if err != nil {
+			return nil, nil, err
+		}
+		palette[i] = rune(char)
+	}
+
+	// the cells grow with the runs read rather than with the size the
+	// header claims, so a short frame claiming to be big costs nothing
+	var cells []rune
+	for len(cells) < width*height {
+		count, err := readUvarint()
+		if err != nil {
+			return nil, nil, err
+		}
+		index, err := readUvarint()
+		if err != nil {
+			return nil, nil, err
+		}
+		if index >= paletteLen {
+			return nil, nil, fmt.Errorf("glyph %d not in palette", index)
+		}
+		if count > uint64(width*height-len(cells)) {
+			return nil, nil, errors.New("frame glyphs overflow")
+		}
+		for range count {
+			cells = append(cells, palette[index])
+		}
+	}
+
+	frame := make(Frame, height)
+	for rowIdx := range frame {
+		frame[rowIdx] = cells[rowIdx*width : (rowIdx+1)*width]
+	}
+	return frame, data, nil
+}
+
+// decodeColors reads the color runs of one rows x cols plane and returns
+// the data left after them.
+func decodeColors(data []byte, mode ColorMode, rows, cols int) ([][]Color, []byte, error) {
+	var size int
+	switch mode {
+	case Color256:
+		size = 1
+	case TrueColor:
+		size = 3
+	default:
+		return nil, nil, fmt.Errorf("unknown color mode %d", mode)
+	}
+
+	total := rows * cols
+	var cells []Color
+	i := 0
+	for ; len(cells) < total && i+1+size <= len(data); i += 1 + size {
+		var c Color
+		if mode == Color256 {
+			c = From256(data[i+1])
+		} else {
+			c = Color{data[i+1], data[i+2], data[i+3]}
+		}
+		for range data[i] {
+			cells = append(cells, c)
+		}
+	}
+
+	if len(cells) != total {
+		return nil, nil, errors.New("frame colors do not match glyphs")
+	}
+
+	fg := make([][]Color, rows)
+	for rowIdx := range fg {
+		fg[rowIdx] = cells[rowIdx*cols : (rowIdx+1)*cols]
+	}
+	return fg, data[i:], nil
+}
+
 type FrameChunk struct {
 	FrameId        uint32
-	SequenceNumber uint8
-	TotalChunks    uint8
+	SequenceNumber uint16
+	TotalChunks    uint16
 	Data           []byte
 }
 
+// maxChunks is how many chunks a frame can be split into.
+const maxChunks = math.MaxUint16
+
+// Encode lays the chunk out as [frame id uint32][sequence][total][data].
+// Sequence numbers or totals past 255, which one byte cannot count, zero
+// both bytes and follow them with [sequence uint16][total uint16].
 func (c *FrameChunk) Encode() []byte {
+	if c.TotalChunks > math.MaxUint8 || c.SequenceNumber > math.MaxUint8 {
+		buf := make([]byte, 4+2+4+len(c.Data))
+		binary.LittleEndian.PutUint32(buf[:4], c.FrameId)
+		binary.LittleEndian.PutUint16(buf[6:8], c.SequenceNumber)
+		binary.LittleEndian.PutUint16(buf[8:10], c.TotalChunks)
+		copy(buf[10:], c.Data)
+		return buf
+	}
+
 	size := 4 + 1 + 1 + len(c.Data)
 	buf := make([]byte, size)
 	binary.LittleEndian.PutUint32(buf[:4], c.FrameId)
-	buf[4] = c.SequenceNumber
-	buf[5] = c.TotalChunks
+	buf[4] = uint8(c.SequenceNumber)
+	buf[5] = uint8(c.TotalChunks)
 	copy(buf[6:], c.Data)
 	return buf
 }
@@ -108,10 +570,19 @@ func (c *FrameChunk) Decode(bs []byte) error {
 	}
 
 	frameId := binary.LittleEndian.Uint32(bs[:4])
-	seqNum := bs[4]
-	totalChunks := bs[5]
+	seqNum := uint16(bs[4])
+	totalChunks := uint16(bs[5])
 	data := bs[6:]
 
+	if totalChunks == 0 {
+		if len(bs) < 10 {
+			return errors.New("frame chunk too small")
+		}
+		seqNum = binary.LittleEndian.Uint16(bs[6:8])
+		totalChunks = binary.LittleEndian.Uint16(bs[8:10])
+		data = bs[10:]
+	}
+
 	c.FrameId = frameId
 	c.SequenceNumber = seqNum
 	c.TotalChunks = totalChunks
@@ -126,12 +597,16 @@ func (c *FrameChunk) Decode(bs []byte) error {
 // dataLen=8
 // totalChunks=2+1=3
 
+// ChunkFrameData returns nil for data too big for maxChunks chunks.
 func ChunkFrameData(data []byte, size int, id uint32, ts time.Time) []FrameChunk {
 	timestampBytes := make([]byte, 8) // Assuming 64-bit timestamp
 	binary.LittleEndian.PutUint64(timestampBytes, uint64(ts.UnixMilli()))
 	data = append(timestampBytes, data...)
 	dataLen := len(data)
 	totalChunks := (dataLen + size - 1) / size
+	if totalChunks > maxChunks {
+		return nil
+	}
 	chunks := make([]FrameChunk, totalChunks)
 
 	for chunkIdx := 0; chunkIdx < totalChunks; chunkIdx++ {
@@ -143,8 +618,8 @@ func ChunkFrameData(data []byte, size int, id uint32, ts time.Time) []FrameChunk
 		c := data[start:end]
 		frameChunk := FrameChunk{
 			FrameId:        id,
-			SequenceNumber: uint8(chunkIdx),
-			TotalChunks:    uint8(totalChunks),
+			SequenceNumber: uint16(chunkIdx),
+			TotalChunks:    uint16(totalChunks),
 			Data:           c,
 		}
 		chunks[chunkIdx] = frameChunk
@@ -153,47 +628,333 @@ func ChunkFrameData(data []byte, size int, id uint32, ts time.Time) []FrameChunk
 	return chunks
 }
 
-type FrameChunkCatcher map[uint32][]FrameChunk
+// Limits on the chunks a FrameChunkCatcher holds for frames still
+// missing some.
+const (
+	// catchWindow is how long a frame has for all its chunks to arrive
+	catchWindow = time.Second
+	// maxCaughtBytes caps the chunk data held, the oldest frames going
+	// first
+	maxCaughtBytes = 4 << 20
+	// chunkSlot is what holding a chunk costs before it arrives, a slice
+	// header, charged to the cap so frames claiming many chunks count
+	chunkSlot = 24
+	// nackDelay is how long a frame waits for its chunks before asking
+	// for the missing ones, and between asking again
+	nackDelay = 30 * time.Millisecond
+	// maxNacks is how often the chunks of one frame are asked for
+	maxNacks = 2
+)
+
+// CatcherStats counts what a FrameChunkCatcher put together and what it
+// had to throw away.
+type CatcherStats struct {
+	// Frames were put together and returned
+	Frames int
+	// Incomplete frames were evicted before all their chunks arrived
+	Incomplete int
+	// Dropped frames were put together but not returned, being older
+	// than the last one, undecodable or a delta without its reference
+	Dropped int
+	// Duplicates are chunks received more than once
+	Duplicates int
+	// Malformed chunks could not be decoded or disagreed with the other
+	// chunks of their frame on how many there are
+	Malformed int
+	// Recovered chunks were rebuilt from parity chunks
+	Recovered int
+}
+
+// FrameChunkCatcher puts the frames of one sender back together from
+// their chunks, applying delta frames to the frame they were made from.
+type FrameChunkCatcher struct {
+	chunks map[uint32]*caughtFrame
+	// buffered is the chunk data held in chunks
+	buffered int
+	window   time.Duration
+	maxBytes int
+	stats    CatcherStats
+	// expected and lost count the data chunks of the frames finished
+	// since the last call to Loss
+	expected int
+	lost     int
+	// last is the newest frame put together, the reference of the next
+	// delta frame
+	last   ColorFrame
+	lastId uint32
+	// forgotten holds when the frames given up on or finished in the
+	// last window were, so their late chunks are not held again
+	forgotten map[uint32]time.Time
+	// missing is set from a delta frame whose reference was lost until
+	// the next keyframe
+	missing bool
+}
+
+// caughtFrame holds the chunks of a frame until all have arrived.
+type caughtFrame struct {
+	// chunks by sequence number, nil data where not arrived yet
+	chunks [][]byte
+	// parity chunks by group
+	parity   map[int][]byte
+	received int
+	// direct counts the data chunks that arrived rather than being
+	// recovered
+	direct  int
+	bytes   int
+	started time.Time
+	// nacks counts the times missing chunks were asked for, the last at
+	// nacked
+	nacks  int
+	nacked time.Time
+}
+
+// MissingChunks are the data chunks of a frame that have not arrived.
+type MissingChunks struct {
+	FrameId   uint32
+	Sequences []uint16
+}
+
+func NewFrameCatcher() *FrameChunkCatcher {
+	return &FrameChunkCatcher{
+		chunks:    make(map[uint32]*caughtFrame),
+		forgotten: make(map[uint32]time.Time),
+		window:    catchWindow,
+		maxBytes:  maxCaughtBytes,
+	}
+}
+
+// NeedsKeyframe reports whether delta frames are being dropped for want
+// of the frame they were made from, which only a keyframe can fix.
+func (fcc *FrameChunkCatcher) NeedsKeyframe() bool {
+	return fcc.missing
+}
+
+// Stats returns the counts since the catcher was made.
+func (fcc *FrameChunkCatcher) Stats() CatcherStats {
+	return fcc.stats
+}
+
+// Missing returns the chunks of the frames that have been waiting longer
+// than nackDelay, for the sender to send again. The chunks of a frame are
+// asked for at most maxNacks times, nackDelay apart.
+func (fcc *FrameChunkCatcher) Missing(now time.Time) []MissingChunks {
+	var missing []MissingChunks
+	for id, caught := range fcc.chunks {
+		if caught.nacks >= maxNacks || now.Sub(caught.started) < nackDelay ||
+			now.Sub(caught.nacked) < nackDelay {
+			continue
+		}
+
+		m := MissingChunks{FrameId: id}
+		for seq, data := range caught.chunks {
+			if data == nil {
+				m.Sequences = append(m.Sequences, uint16(seq))
+			}
+		}
+		caught.nacks++
+		caught.nacked = now
+		missing = append(missing, m)
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return int32(missing[i].FrameId-missing[j].FrameId) < 0
+	})
+	return missing
+}
 
-func NewFrameCatcher() FrameChunkCatcher {
-	return make(FrameChunkCatcher)
+// Loss returns the fraction of data chunks that did not arrive in the
+// frames finished since the last call, and false when there were none.
+func (fcc *FrameChunkCatcher) Loss() (float64, bool) {
+	expected, lost := fcc.expected, fcc.lost
+	fcc.expected, fcc.lost = 0, 0
+	if expected == 0 {
+		return 0, false
+	}
+	return float64(lost) / float64(expected), true
 }
 
-func (fcc FrameChunkCatcher) Catch(data []byte) (Frame, uint64) {
+func (fcc *FrameChunkCatcher) Catch(data []byte) (Frame, uint64) {
+	frame, ts := fcc.CatchColor(data)
+	return frame.Frame, ts
+}
+
+// CatchColor is Catch for frames that may carry colors.
+func (fcc *FrameChunkCatcher) CatchColor(data []byte) (ColorFrame, uint64) {
 
 	var chunk FrameChunk
 	err := (&chunk).Decode(data)
 	if err != nil {
-		fmt.Printf("ERROR: decoding chunk: %s\n", err)
-		return nil, 0
+		fcc.stats.Malformed++
+		return ColorFrame{}, 0
+	}
+	// parity chunks follow the data chunks, one for every group of them
+	isParity := chunk.SequenceNumber >= chunk.TotalChunks
+	if chunk.TotalChunks == 0 || int(chunk.SequenceNumber) >= 2*int(chunk.TotalChunks) ||
+		isParity && len(chunk.Data) < 3 {
+		fcc.stats.Malformed++
+		return ColorFrame{}, 0
+	}
+
+	now := time.Now()
+	fcc.evictOld(now)
+
+	if chunk.TotalChunks == 1 && !isParity {
+		fcc.expected++
+		return fcc.decode(chunk.FrameId, chunk.Data)
+	}
+	if fcc.last.Frame != nil && int32(chunk.FrameId-fcc.lastId) <= 0 {
+		// a late chunk of a frame already shown or given up on
+		return ColorFrame{}, 0
+	}
+	if _, ok := fcc.forgotten[chunk.FrameId]; ok {
+		// the same, before any frame was shown or after ones that failed
+		// to decode
+		return ColorFrame{}, 0
+	}
+
+	caught, ok := fcc.chunks[chunk.FrameId]
+	if !ok {
+		caught = &caughtFrame{
+			chunks:  make([][]byte, chunk.TotalChunks),
+			parity:  make(map[int][]byte),
+			bytes:   int(chunk.TotalChunks) * chunkSlot,
+			started: now,
+		}
+		fcc.chunks[chunk.FrameId] = caught
+		fcc.buffered += caught.bytes
+	}
+	if int(chunk.TotalChunks) != len(caught.chunks) {
+		fcc.stats.Malformed++
+		return ColorFrame{}, 0
+	}
+
+	if isParity {
+		g := int(chunk.SequenceNumber - chunk.TotalChunks)
+		if caught.parity[g] != nil {
+			fcc.stats.Duplicates++
+			return ColorFrame{}, 0
+		}
+		caught.parity[g] = chunk.Data
+	} else {
+		if caught.chunks[chunk.SequenceNumber] != nil {
+			fcc.stats.Duplicates++
+			return ColorFrame{}, 0
+		}
+		caught.chunks[chunk.SequenceNumber] = chunk.Data
+		caught.received++
+		caught.direct++
 	}
+	caught.bytes += len(chunk.Data)
+	fcc.buffered += len(chunk.Data)
 
-	if chunk.TotalChunks == 1 {
-		ts := binary.LittleEndian.Uint64(chunk.Data[:8])
-		return RunLengthDecode(chunk.Data[8:]), ts
+	if caught.received < len(caught.chunks) && len(caught.parity) > 0 {
+		fcc.stats.Recovered += caught.recover()
 	}
 
-	if chunks, ok := fcc[chunk.FrameId]; ok {
-		chunks = append(chunks, chunk)
-		if len(chunks) == int(chunk.TotalChunks) {
-			sort.Slice(chunks, func(i, j int) bool {
-				return chunks[i].SequenceNumber < chunks[j].SequenceNumber
-			})
-			joinedData := []byte{}
-			for _, c := range chunks {
-				joinedData = append(joinedData, c.Data...)
+	if caught.received < len(caught.chunks) {
+		fcc.evictOverCap(chunk.FrameId)
+		return ColorFrame{}, 0
+	}
+
+	joinedData := make([]byte, 0, caught.bytes-len(caught.chunks)*chunkSlot)
+	for _, c := range caught.chunks {
+		joinedData = append(joinedData, c...)
+	}
+	fcc.forget(chunk.FrameId)
+	return fcc.decode(chunk.FrameId, joinedData)
+}
+
+// forget drops the chunks of frame id, counting its lost chunks.
+func (fcc *FrameChunkCatcher) forget(id uint32) {
+	caught := fcc.chunks[id]
+	fcc.expected += len(caught.chunks)
+	fcc.lost += len(caught.chunks) - caught.direct
+	fcc.buffered -= caught.bytes
+	delete(fcc.chunks, id)
+	fcc.forgotten[id] = time.Now()
+}
+
+// evictOld gives up on the frames that did not come together within the
+// window.
+func (fcc *FrameChunkCatcher) evictOld(now time.Time) {
+	for id, caught := range fcc.chunks {
+		if now.Sub(caught.started) > fcc.window {
+			fcc.forget(id)
+			fcc.stats.Incomplete++
+		}
+	}
+	for id, at := range fcc.forgotten {
+		if now.Sub(at) > fcc.window {
+			delete(fcc.forgotten, id)
+		}
+	}
+}
+
+// evictOlderThan gives up on the frames before id, which can no longer
+// be shown once id is.
+func (fcc *FrameChunkCatcher) evictOlderThan(id uint32) {
+	for pending := range fcc.chunks {
+		if int32(pending-id) < 0 {
+			fcc.forget(pending)
+			fcc.stats.Incomplete++
+		}
+	}
+}
+
+// evictOverCap gives up on the oldest frames until the chunks held fit
+// the byte cap, sparing frame keep unless it is too big on its own.
+func (fcc *FrameChunkCatcher) evictOverCap(keep uint32) {
+	for fcc.buffered > fcc.maxBytes {
+		oldest, found := keep, false
+		for id := range fcc.chunks {
+			if id != keep && (!found || int32(id-oldest) < 0) {
+				oldest, found = id, true
 			}
-			delete(fcc, chunk.FrameId)
-			ts := binary.LittleEndian.Uint64(joinedData[:8])
-			return RunLengthDecode(joinedData[8:]), ts
 		}
+		fcc.forget(oldest)
+		fcc.stats.Incomplete++
+		if !found {
+			return
+		}
+	}
+}
+
+// decode splits the timestamp ChunkFrameData put in front of the encoded
+// frame and decodes frame id, dropping frames older than the last one.
+func (fcc *FrameChunkCatcher) decode(id uint32, data []byte) (ColorFrame, uint64) {
+	if len(data) < 8 {
+		fcc.stats.Dropped++
+		return ColorFrame{}, 0
+	}
+	ts := binary.LittleEndian.Uint64(data[:8])
+	data = data[8:]
+
+	if fcc.last.Frame != nil && int32(id-fcc.lastId) <= 0 {
+		fcc.stats.Dropped++
+		return ColorFrame{}, 0
+	}
 
-		fcc[chunk.FrameId] = chunks
+	var frame ColorFrame
+	var err error
+	if ref, ok := deltaReference(data); ok {
+		if fcc.last.Frame == nil || ref != fcc.lastId {
+			fcc.missing = true
+			fcc.stats.Dropped++
+			return ColorFrame{}, 0
+		}
+		frame, err = decodeDelta(data, fcc.last)
 	} else {
-		chunks := []FrameChunk{}
-		chunks = append(chunks, chunk)
-		fcc[chunk.FrameId] = chunks
+		frame, err = DecodeFrame(data)
+		if err == nil {
+			fcc.missing = false
+		}
+	}
+	if err != nil {
+		fcc.stats.Dropped++
+		return ColorFrame{}, 0
 	}
 
-	return nil, 0
+	fcc.last, fcc.lastId = frame, id
+	fcc.evictOlderThan(id)
+	fcc.stats.Frames++
+	return frame, ts
 }
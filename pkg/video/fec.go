@@ -0,0 +1,133 @@
+package video
+
+import "encoding/binary"
+
+// AddParity appends an XOR parity chunk for every group data chunks of a
+// frame, so the catcher can rebuild one lost chunk per group. Parity
+// chunk g covers data chunks g*group up to (g+1)*group, has the sequence
+// number TotalChunks+g and carries
+//
+//	[group][xor of the chunk lengths uint16][xor of the chunks, zero padded]
+//
+// A group of zero or less adds nothing.
+func AddParity(chunks []FrameChunk, group int) []FrameChunk {
+	if group <= 0 || group > 255 || len(chunks) == 0 {
+		return chunks
+	}
+	total := len(chunks)
+	groups := (total + group - 1) / group
+	if total+groups > maxChunks {
+		return chunks
+	}
+
+	for g := range groups {
+		start, end := g*group, min((g+1)*group, total)
+		var size int
+		for _, c := range chunks[start:end] {
+			size = max(size, len(c.Data))
+		}
+
+		data := make([]byte, 3+size)
+		data[0] = byte(group)
+		var lengths uint16
+		for _, c := range chunks[start:end] {
+			lengths ^= uint16(len(c.Data))
+			xorInto(data[3:], c.Data)
+		}
+		binary.LittleEndian.PutUint16(data[1:3], lengths)
+
+		chunks = append(chunks, FrameChunk{
+			FrameId:        chunks[0].FrameId,
+			SequenceNumber: uint16(total + g),
+			TotalChunks:    uint16(total),
+			Data:           data,
+		})
+	}
+	return chunks
+}
+
+func xorInto(dst, src []byte) {
+	for i, b := range src {
+		dst[i] ^= b
+	}
+}
+
+// covers reports whether parity is long enough to XOR every chunk into.
+func covers(parity []byte, chunks [][]byte) bool {
+	for _, c := range chunks {
+		if len(c) > len(parity) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParityGroup picks how many data chunks share a parity chunk for the
+// fraction of chunks lost, zero when there is too little loss to bother.
+// One parity chunk per group rebuilds one lost chunk, so the group
+// shrinks as the loss grows.
+func ParityGroup(loss float64) int {
+	switch {
+	case loss < 0.005:
+		return 0
+	case loss < 0.02:
+		return 8
+	case loss < 0.05:
+		return 4
+	case loss < 0.1:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// recover rebuilds the data chunk of every group that is missing only
+// one and has its parity chunk.
+func (caught *caughtFrame) recover() int {
+	var recovered int
+	for g, parity := range caught.parity {
+		group := int(parity[0])
+		start := g * group
+		if group == 0 || start >= len(caught.chunks) {
+			continue
+		}
+		end := min(start+group, len(caught.chunks))
+
+		lost := -1
+		for i := start; i < end; i++ {
+			if caught.chunks[i] != nil {
+				continue
+			}
+			if lost >= 0 {
+				lost = -1
+				break
+			}
+			lost = i
+		}
+		if lost < 0 {
+			continue
+		}
+
+		// the parity is as long as the longest chunk it covers, so a
+		// shorter one is not the parity of these chunks
+		data := append([]byte(nil), parity[3:]...)
+		if !covers(data, caught.chunks[start:end]) {
+			continue
+		}
+		length := binary.LittleEndian.Uint16(parity[1:3])
+		for i := start; i < end; i++ {
+			if i != lost {
+				xorInto(data, caught.chunks[i])
+				length ^= uint16(len(caught.chunks[i]))
+			}
+		}
+		if int(length) > len(data) {
+			continue
+		}
+
+		caught.chunks[lost] = data[:length]
+		caught.received++
+		recovered++
+	}
+	return recovered
+}
@@ -0,0 +1,173 @@
+package video
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParity(t *testing.T) {
+	frame := Frame{[]rune("a frame long enough for a few chunks and parity")}
+	chunks := func(group int) []FrameChunk {
+		return AddParity(ChunkFrameData(frame.RunLengthEncode(), 8, 1, time.Now()), group)
+	}
+	// 8 byte timestamp and 1+2*47 bytes of rle
+	const n = 13
+
+	t.Run("parity chunks", func(t *testing.T) {
+		cs := chunks(3)
+		if len(cs) != n+5 {
+			t.Fatalf("expected %d chunks, got %d", n+5, len(cs))
+		}
+		for i, c := range cs[n:] {
+			if c.SequenceNumber != uint16(n+i) || c.TotalChunks != n {
+				t.Errorf("parity %d: expected %d of %d, got %d of %d", i, n+i, n, c.SequenceNumber, c.TotalChunks)
+			}
+		}
+	})
+
+	t.Run("recover one lost chunk per group", func(t *testing.T) {
+		// every data chunk in turn, the last one being shorter
+		for lost := range n {
+			fcc := NewFrameCatcher()
+			var caught Frame
+			for i, c := range chunks(3) {
+				if i == lost {
+					continue
+				}
+				if f, _ := fcc.Catch(c.Encode()); f != nil {
+					caught = f
+				}
+			}
+			if !reflect.DeepEqual(caught, frame) {
+				t.Errorf("lost %d\nExpected:\n%s\nGot:\n%s", lost, frame, caught)
+			}
+			if stats := fcc.Stats(); stats.Recovered != 1 {
+				t.Errorf("lost %d: expected 1 recovered chunk, got %+v", lost, stats)
+			}
+		}
+	})
+
+	t.Run("two lost in a group", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		for i, c := range chunks(3) {
+			if i == 0 || i == 1 {
+				continue
+			}
+			if f, _ := fcc.Catch(c.Encode()); f != nil {
+				t.Fatalf("expected no frame with two chunks of a group lost")
+			}
+		}
+	})
+
+	t.Run("parity before data", func(t *testing.T) {
+		cs := chunks(n)
+		fcc := NewFrameCatcher()
+		fcc.Catch(cs[n].Encode())
+		var caught Frame
+		for _, c := range cs[1:n] {
+			if f, _ := fcc.Catch(c.Encode()); f != nil {
+				caught = f
+			}
+		}
+		if !reflect.DeepEqual(caught, frame) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", frame, caught)
+		}
+	})
+
+	t.Run("short parity", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		cs := []FrameChunk{
+			{FrameId: 1, SequenceNumber: 0, TotalChunks: 3, Data: make([]byte, 10)},
+			{FrameId: 1, SequenceNumber: 1, TotalChunks: 3, Data: make([]byte, 10)},
+			{FrameId: 1, SequenceNumber: 3, TotalChunks: 3, Data: []byte{3, 0, 0, 0}},
+		}
+		for _, c := range cs {
+			if f, _ := fcc.Catch(c.Encode()); f != nil {
+				t.Fatalf("expected no frame from parity shorter than its chunks")
+			}
+		}
+		if stats := fcc.Stats(); stats.Recovered != 0 {
+			t.Errorf("expected nothing recovered, got %+v", stats)
+		}
+	})
+
+	t.Run("loss", func(t *testing.T) {
+		fcc := NewFrameCatcher()
+		for i, c := range chunks(4) {
+			if i != 2 {
+				fcc.Catch(c.Encode())
+			}
+		}
+		if loss, ok := fcc.Loss(); !ok || loss != 1.0/n {
+			t.Errorf("expected a loss of 1/%d, got %v", n, loss)
+		}
+		if _, ok := fcc.Loss(); ok {
+			t.Errorf("expected no loss to report after it was taken")
+		}
+	})
+}
+
+func TestParityGroup(t *testing.T) {
+	previous := ParityGroup(0)
+	if previous != 0 {
+		t.Errorf("expected no parity without loss, got groups of %d", previous)
+	}
+	for _, loss := range []float64{0.01, 0.03, 0.07, 0.2} {
+		group := ParityGroup(loss)
+		if group == 0 || (previous != 0 && group > previous) {
+			t.Errorf("expected groups to shrink as loss grows, got %d after %d at %v", group, previous, loss)
+		}
+		previous = group
+	}
+}
+
+func TestMissing(t *testing.T) {
+	frame := Frame{[]rune("a frame long enough for a few chunks")}
+	chunks := ChunkFrameData(frame.RunLengthEncode(), 8, 1, time.Now())
+
+	ring := NewChunkRing(4)
+	for _, c := range chunks {
+		ring.Add(c)
+	}
+
+	fcc := NewFrameCatcher()
+	lost := []int{len(chunks) - 3, len(chunks) - 1}
+	for i, c := range chunks {
+		if i != lost[0] && i != lost[1] {
+			fcc.Catch(c.Encode())
+		}
+	}
+
+	if missing := fcc.Missing(time.Now()); len(missing) != 0 {
+		t.Errorf("expected to wait before asking, got %+v", missing)
+	}
+
+	now := time.Now().Add(nackDelay)
+	missing := fcc.Missing(now)
+	expected := []MissingChunks{{FrameId: 1, Sequences: []uint16{uint16(lost[0]), uint16(lost[1])}}}
+	if !reflect.DeepEqual(missing, expected) {
+		t.Fatalf("Expected: %+v\nGot: %+v", expected, missing)
+	}
+	if again := fcc.Missing(now); len(again) != 0 {
+		t.Errorf("expected to wait before asking again, got %+v", again)
+	}
+
+	// the ring only remembers the last 4 chunks sent, which is enough
+	var caught Frame
+	for _, seq := range missing[0].Sequences {
+		c, ok := ring.Get(1, seq)
+		if !ok {
+			t.Fatalf("expected chunk %d in the ring", seq)
+		}
+		if f, _ := fcc.Catch(c.Encode()); f != nil {
+			caught = f
+		}
+	}
+	if !reflect.DeepEqual(caught, frame) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", frame, caught)
+	}
+	if _, ok := ring.Get(1, 0); ok {
+		t.Errorf("expected the first chunk to be forgotten")
+	}
+}
@@ -0,0 +1,280 @@
+package video
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Gallery tiles the frames of several peers across the terminal, one
+// labeled tile per peer, redrawing each tile independently. The bottom
+// row is kept free for a status line.
+type Gallery struct {
+	rows        int
+	cols        int
+	names       map[uint32]string
+	tiles       map[uint32]*tile
+	status      string
+	placeholder string
+	mode        ColorMode
+	// speaking holds the peers whose labels are highlighted
+	speaking map[uint32]bool
+}
+
+type tile struct {
+	name string
+	// top-left corner of the label, 0-based
+	row int
+	col int
+	// space available for the frame below the label
+	width    int
+	height   int
+	shown    ColorFrame
+	speaking bool
+}
+
+func NewGallery(rows, cols int) *Gallery {
+	return &Gallery{
+		rows:     max(rows-1, 1),
+		cols:     cols,
+		names:    make(map[uint32]string),
+		tiles:    make(map[uint32]*tile),
+		speaking: make(map[uint32]bool),
+	}
+}
+
+// SetColorMode sets how many colors the tiles are drawn with.
+func (g *Gallery) SetColorMode(mode ColorMode) {
+	g.mode = mode
+}
+
+// SetPeers replaces the set of peers shown and relays out the grid.
+func (g *Gallery) SetPeers(names map[uint32]string) {
+	g.names = make(map[uint32]string, len(names))
+	for id, name := range names {
+		g.names[id] = name
+	}
+	for id := range g.speaking {
+		if _, ok := names[id]; !ok {
+			delete(g.speaking, id)
+		}
+	}
+	g.layout()
+}
+
+// SetSpeaking highlights the label of peer id while it speaks.
+func (g *Gallery) SetSpeaking(id uint32, speaking bool) {
+	if g.speaking[id] == speaking {
+		return
+	}
+	if speaking {
+		g.speaking[id] = true
+	} else {
+		delete(g.speaking, id)
+	}
+	if t, ok := g.tiles[id]; ok {
+		t.speaking = speaking
+		t.label()
+	}
+}
+
+// Show draws frame into the tile of peer id, adding a tile for peers
+// that are not known yet.
+func (g *Gallery) Show(id uint32, frame ColorFrame) {
+	t, ok := g.tiles[id]
+	if !ok {
+		g.names[id] = fmt.Sprintf("%08x", id)
+		g.layout()
+		t = g.tiles[id]
+	}
+
+	scaled := frame.scale(t.width, t.height)
+	if ups := scaled.diff(t.shown, g.mode); ups != nil {
+		ups.doAt(t.row+1, t.col)
+	} else {
+		t.clear()
+		t.draw(scaled, g.mode)
+	}
+	t.shown = scaled
+}
+
+// Status replaces the text of the status line, clearing it when empty.
+func (g *Gallery) Status(status string) {
+	g.status = status
+	g.drawStatus()
+}
+
+func (g *Gallery) drawStatus() {
+	moveCursor(g.rows+1, 1)
+	fmt.Print("\033[2K")
+	fmt.Print(g.status)
+}
+
+// Placeholder sets the text shown in the middle of the screen while
+// there are no peers to show.
+func (g *Gallery) Placeholder(text string) {
+	if text == g.placeholder {
+		return
+	}
+	g.placeholder = text
+	if len(g.tiles) == 0 {
+		g.layout()
+	}
+}
+
+func (g *Gallery) drawPlaceholder() {
+	text, width := truncate(g.placeholder, g.cols)
+	moveCursor(g.rows/2+1, max((g.cols-width)/2, 0)+1)
+	fmt.Print(text)
+}
+
+// layout splits the terminal into a grid just big enough for every peer,
+// e.g. 2x1 for two, 2x2 for up to four and 3x3 for up to nine.
+func (g *Gallery) layout() {
+	ClearScreen()
+	g.drawStatus()
+	g.tiles = make(map[uint32]*tile, len(g.names))
+	if len(g.names) == 0 {
+		g.drawPlaceholder()
+		return
+	}
+
+	ids := make([]uint32, 0, len(g.names))
+	for id := range g.names {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	gridCols := int(math.Ceil(math.Sqrt(float64(len(ids)))))
+	gridRows := (len(ids) + gridCols - 1) / gridCols
+	tileWidth := g.cols / gridCols
+	tileHeight := g.rows / gridRows
+
+	for i, id := range ids {
+		t := &tile{
+			name:     g.names[id],
+			row:      (i / gridCols) * tileHeight,
+			col:      (i % gridCols) * tileWidth,
+			width:    max(tileWidth-1, 1),
+			height:   max(tileHeight-1, 1),
+			speaking: g.speaking[id],
+		}
+		t.label()
+		g.tiles[id] = t
+	}
+}
+
+func (t *tile) label() {
+	label, _ := truncate("[ "+t.name+" ]", t.width)
+	moveCursor(t.row+1, t.col+1)
+	if t.speaking {
+		fmt.Print(sgrReverse + label + sgrReset)
+	} else {
+		fmt.Print(label)
+	}
+}
+
+// truncate cuts text to at most width terminal cells, never in the middle
+// of a character, returning it with the cells it takes.
+func truncate(text string, width int) (string, int) {
+	used := 0
+	for i, r := range text {
+		w := cellWidth(r)
+		if used+w > width {
+			return text[:i], used
+		}
+		used += w
+	}
+	return text, used
+}
+
+// cellWidth is how many terminal cells r takes: none for marks combining
+// with the character before, two for wide East Asian characters and
+// emoji, one for the rest.
+func cellWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+func (t *tile) clear() {
+	blank := strings.Repeat(" ", t.width)
+	for rowIdx := range t.height {
+		moveCursor(t.row+rowIdx+2, t.col+1)
+		fmt.Print(blank)
+	}
+}
+
+func (t *tile) draw(f ColorFrame, mode ColorMode) {
+	for rowIdx := range f.Frame {
+		moveCursor(t.row+rowIdx+2, t.col+1)
+		fmt.Print(f.render(rowIdx, mode))
+	}
+}
+
+// scale fits the frame into width x height cells, keeping its aspect
+// ratio, by picking the nearest source cell for every target cell.
+func (f Frame) scale(width, height int) Frame {
+	if len(f) == 0 || len(f[0]) == 0 {
+		return f
+	}
+	srcRows, srcCols := len(f), len(f[0])
+
+	factor := math.Min(float64(width)/float64(srcCols), float64(height)/float64(srcRows))
+	cols := max(int(float64(srcCols)*factor), 1)
+	rows := max(int(float64(srcRows)*factor), 1)
+
+	if rows == srcRows && cols == srcCols {
+		return f
+	}
+	return resample(f, rows, cols)
+}
+
+// scale is Frame.scale for the glyphs and their colors alike.
+func (f ColorFrame) scale(width, height int) ColorFrame {
+	scaled := ColorFrame{Frame: f.Frame.scale(width, height), Charset: f.Charset}
+	if len(scaled.Frame) == 0 {
+		return scaled
+	}
+	rows, cols := len(scaled.Frame), len(scaled.Frame[0])
+	scaled.FG = resampleColors(f.FG, rows, cols)
+	scaled.BG = resampleColors(f.BG, rows, cols)
+	return scaled
+}
+
+func resampleColors(colors [][]Color, rows, cols int) [][]Color {
+	if colors == nil || (rows == len(colors) && cols == len(colors[0])) {
+		return colors
+	}
+	return resample(colors, rows, cols)
+}
+
+// resample picks the nearest source cell for every cell of a rows x cols
+// grid.
+func resample[T any](grid [][]T, rows, cols int) [][]T {
+	srcRows, srcCols := len(grid), len(grid[0])
+	scaled := make([][]T, rows)
+	for rowIdx := range rows {
+		srcRow := grid[rowIdx*srcRows/rows]
+		scaled[rowIdx] = make([]T, cols)
+		for colIdx := range cols {
+			scaled[rowIdx][colIdx] = srcRow[colIdx*srcCols/cols]
+		}
+	}
+	return scaled
+}
@@ -0,0 +1,58 @@
+package video
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	frame := Frame{
+		{'a', 'a', 'b', 'b'},
+		{'a', 'a', 'b', 'b'},
+		{'c', 'c', 'd', 'd'},
+		{'c', 'c', 'd', 'd'},
+	}
+
+	t.Run("downscale", func(t *testing.T) {
+		expected := Frame{{'a', 'b'}, {'c', 'd'}}
+		if scaled := frame.scale(2, 2); !reflect.DeepEqual(scaled, expected) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", expected, scaled)
+		}
+	})
+
+	t.Run("keeps aspect ratio", func(t *testing.T) {
+		scaled := frame.scale(4, 2)
+		if len(scaled) != 2 || len(scaled[0]) != 2 {
+			t.Errorf("expected 2x2, got %dx%d", len(scaled), len(scaled[0]))
+		}
+	})
+
+	t.Run("same size", func(t *testing.T) {
+		if scaled := frame.scale(4, 4); !reflect.DeepEqual(scaled, frame) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", frame, scaled)
+		}
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		width    int
+		expected string
+		cells    int
+	}{
+		{"bro", 5, "bro", 3},
+		{"brogram", 3, "bro", 3},
+		{"Zoë", 2, "Zo", 2},
+		{"Zoë", 3, "Zoë", 3},
+		// a combining diaeresis stays with its letter
+		{"Zoe\u0308y", 3, "Zoe\u0308", 3},
+		{"日本語", 5, "日本", 4},
+		{"日本語", 1, "", 0},
+	} {
+		got, cells := truncate(test.text, test.width)
+		if got != test.expected || cells != test.cells {
+			t.Errorf("%q in %d\nExpected: %q, %d cells\nGot: %q, %d cells", test.text, test.width, test.expected, test.cells, got, cells)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// imageInterval is how long each image of a directory source is shown.
+const imageInterval = 100 * time.Millisecond
+
+var imageExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+}
+
+// imageDirSource shows the images of a directory in name order, looping
+// at the end.
+type imageDirSource struct {
+	paths   []string
+	idx     int
+	width   int
+	charset Charset
+	next    time.Time
+}
+
+func newImageDirSource(dir string, width int, charset Charset) (*imageDirSource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(e.Name()))] {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no images in " + dir)
+	}
+	sort.Strings(paths)
+
+	return &imageDirSource{paths: paths, width: width, charset: charset}, nil
+}
+
+func (s *imageDirSource) Next() (ColorFrame, error) {
+	time.Sleep(time.Until(s.next))
+	s.next = time.Now().Add(imageInterval)
+
+	path := s.paths[s.idx]
+	s.idx = (s.idx + 1) % len(s.paths)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return ColorFrame{}, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return ColorFrame{}, fmt.Errorf("could not read image %s: %w", path, err)
+	}
+	return s.charset.Convert(img, s.width), nil
+}
+
+func (s *imageDirSource) Close() error {
+	return nil
+}
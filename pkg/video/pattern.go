@@ -0,0 +1,117 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"time"
+)
+
+const patternInterval = time.Second / 30
+
+// patternSource draws a scrolling diagonal gradient in rainbow colors
+// with a white box bouncing across it, so a bro without a camera still
+// sends something moving.
+type patternSource struct {
+	width   int
+	charset Charset
+	img     *image.RGBA
+	tick    int
+	next    time.Time
+}
+
+func newPatternSource(width int, charset Charset) *patternSource {
+	// one pixel per column, in the 4:3 shape of a camera
+	height := max(width*3/4, 1)
+	return &patternSource{
+		width:   width,
+		charset: charset,
+		img:     image.NewRGBA(image.Rect(0, 0, width, height)),
+	}
+}
+
+func (s *patternSource) Next() (ColorFrame, error) {
+	time.Sleep(time.Until(s.next))
+	s.next = time.Now().Add(patternInterval)
+
+	s.draw(s.tick)
+	s.tick++
+	return s.charset.Convert(s.img, s.width), nil
+}
+
+func (s *patternSource) draw(tick int) {
+	bounds := s.img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	boxWidth := max(width/8, 1)
+	boxHeight := max(height/4, 1)
+	boxCol := bounce(tick, width-boxWidth)
+	boxRow := bounce(tick/2, height-boxHeight)
+
+	period := 2 * len(asciiChars)
+	for y := range height {
+		for x := range width {
+			if y >= boxRow && y < boxRow+boxHeight &&
+				x >= boxCol && x < boxCol+boxWidth {
+				s.img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+				continue
+			}
+			level := (x + y + tick) % period
+			if level >= len(asciiChars) {
+				level = period - 1 - level
+			}
+			c := dim(hue((x*360/width+tick*4)%360), level, len(asciiChars)-1)
+			s.img.SetRGBA(x, y, color.RGBA{c.R, c.G, c.B, 255})
+		}
+	}
+}
+
+// hue returns the fully saturated color at angle degrees on the color
+// wheel.
+func hue(angle int) Color {
+	x := uint8(255 * (60 - abs(angle%120-60)) / 60)
+	switch angle / 60 {
+	case 0:
+		return Color{255, x, 0}
+	case 1:
+		return Color{x, 255, 0}
+	case 2:
+		return Color{0, 255, x}
+	case 3:
+		return Color{0, x, 255}
+	case 4:
+		return Color{x, 0, 255}
+	default:
+		return Color{255, 0, x}
+	}
+}
+
+// dim scales c down to level out of levels.
+func dim(c Color, level, levels int) Color {
+	return Color{
+		uint8(int(c.R) * level / levels),
+		uint8(int(c.G) * level / levels),
+		uint8(int(c.B) * level / levels),
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// bounce moves back and forth between 0 and limit as tick grows.
+func bounce(tick, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	pos := tick % (2 * limit)
+	if pos > limit {
+		pos = 2*limit - pos
+	}
+	return pos
+}
+
+func (s *patternSource) Close() error {
+	return nil
+}
@@ -0,0 +1,136 @@
+package video
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// maxPlayoutFrames caps the frames a Playout holds, the oldest going
+	// first
+	maxPlayoutFrames = 64
+	// offsetCreep is how much of the gap to a later transit time the clock
+	// offset moves per frame, so it follows clocks drifting apart without
+	// jumping at every late frame
+	offsetCreep = 256
+)
+
+// Playout holds the frames of one sender until they are due, so they
+// show at the pace they were captured rather than as they arrive.
+//
+// A frame captured at ts by the sender's clock is due at ts plus the
+// clock offset plus the target delay. The offset is the shortest transit
+// seen, so frames arriving up to delay later than the fastest one still
+// show on time and in order. Sync moves frames to show with the audio
+// captured with them instead.
+type Playout struct {
+	delay  time.Duration
+	offset int64
+	synced bool
+	// lag is how much later than the offset and delay would have them
+	// frames show to keep up with the audio, in milliseconds
+	lag    int64
+	frames []playoutFrame
+	// shown is the timestamp of the last frame returned by Pop
+	shown   uint64
+	started bool
+	stats   PlayoutStats
+}
+
+// PlayoutStats counts the frames a Playout threw away.
+type PlayoutStats struct {
+	// Late frames arrived after a newer one was shown
+	Late int
+	// Skipped frames were due together with a newer one, or pushed out
+	// of a full buffer
+	Skipped int
+}
+
+type playoutFrame struct {
+	frame ColorFrame
+	ts    uint64
+}
+
+func NewPlayout(delay time.Duration) *Playout {
+	return &Playout{delay: delay}
+}
+
+// Stats returns the counts since the playout was made.
+func (p *Playout) Stats() PlayoutStats {
+	return p.stats
+}
+
+// Push adds a frame captured at ts, in milliseconds by the sender's
+// clock, that arrived at now.
+func (p *Playout) Push(frame ColorFrame, ts uint64, now time.Time) {
+	if frame.Frame == nil {
+		return
+	}
+	if p.started && ts < p.shown {
+		p.stats.Late++
+		return
+	}
+
+	transit := now.UnixMilli() - int64(ts)
+	if !p.synced || transit < p.offset {
+		p.offset, p.synced = transit, true
+	} else {
+		p.offset += (transit - p.offset) / offsetCreep
+	}
+
+	i := sort.Search(len(p.frames), func(i int) bool { return p.frames[i].ts > ts })
+	p.frames = append(p.frames, playoutFrame{})
+	copy(p.frames[i+1:], p.frames[i:])
+	p.frames[i] = playoutFrame{frame: frame, ts: ts}
+
+	if len(p.frames) > maxPlayoutFrames {
+		p.frames = p.frames[1:]
+		p.stats.Skipped++
+	}
+}
+
+// Pop returns the newest frame that is due at now, skipping older ones
+// due with it, and false when none is due.
+func (p *Playout) Pop(now time.Time) (ColorFrame, bool) {
+	n := 0
+	for n < len(p.frames) && !p.due(p.frames[n].ts).After(now) {
+		n++
+	}
+	if n == 0 {
+		return ColorFrame{}, false
+	}
+
+	f := p.frames[n-1]
+	p.stats.Skipped += n - 1
+	p.frames = p.frames[n:]
+	p.shown, p.started = f.ts, true
+	return f.frame, true
+}
+
+// Sync keeps frames in step with the audio of the same sender, which
+// played what it captured at ts at time at. Frames are moved to show
+// with that audio once they drift more than tolerance from it.
+func (p *Playout) Sync(ts uint64, at time.Time, tolerance time.Duration) {
+	if !p.synced {
+		return
+	}
+	audio := at.UnixMilli() - int64(ts)
+	video := p.offset + p.delay.Milliseconds() + p.lag
+	if drift := audio - video; time.Duration(abs(int(drift)))*time.Millisecond > tolerance {
+		p.lag += drift
+	}
+}
+
+// Next returns when the oldest frame held is due, and false when none
+// is held.
+func (p *Playout) Next() (time.Time, bool) {
+	if len(p.frames) == 0 {
+		return time.Time{}, false
+	}
+	return p.due(p.frames[0].ts), true
+}
+
+// due is when the frame captured at ts should show.
+func (p *Playout) due(ts uint64) time.Time {
+	return time.UnixMilli(int64(ts) + p.offset + p.lag).Add(p.delay)
+}
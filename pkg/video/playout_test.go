@@ -0,0 +1,126 @@
+package video
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlayout(t *testing.T) {
+	frame := func(s string) ColorFrame {
+		return ColorFrame{Frame: Frame{[]rune(s)}}
+	}
+	start := time.UnixMilli(1_000_000)
+	// the sender's clock runs an hour behind ours
+	ts := func(ms int) uint64 {
+		return uint64(start.Add(-time.Hour).UnixMilli()) + uint64(ms)
+	}
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+	const delay = 100 * time.Millisecond
+
+	t.Run("held for the delay", func(t *testing.T) {
+		p := NewPlayout(delay)
+		p.Push(frame("a"), ts(0), at(0))
+		if _, ok := p.Pop(at(99)); ok {
+			t.Fatalf("expected no frame before the delay")
+		}
+		if due, ok := p.Next(); !ok || !due.Equal(at(100)) {
+			t.Errorf("Expected: %s\nGot: %s %v", at(100), due, ok)
+		}
+		f, ok := p.Pop(at(100))
+		if !ok || !reflect.DeepEqual(f, frame("a")) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", frame("a"), f)
+		}
+	})
+
+	t.Run("paced by capture time", func(t *testing.T) {
+		p := NewPlayout(delay)
+		// captured 40ms apart, arriving unevenly
+		p.Push(frame("a"), ts(0), at(10))
+		p.Push(frame("b"), ts(40), at(60))
+		p.Push(frame("c"), ts(80), at(95))
+		var got []string
+		for ms := 0; ms < 300; ms += 5 {
+			if f, ok := p.Pop(at(ms)); ok {
+				got = append(got, string(f.Frame[0]))
+				if ms != 110+40*(len(got)-1) {
+					t.Errorf("frame %s shown at %dms", string(f.Frame[0]), ms)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("Expected: [a b c]\nGot: %v", got)
+		}
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		p := NewPlayout(delay)
+		p.Push(frame("a"), ts(0), at(0))
+		p.Push(frame("c"), ts(80), at(80))
+		p.Push(frame("b"), ts(40), at(90))
+		var got []string
+		for ms := 0; ms < 300; ms += 5 {
+			if f, ok := p.Pop(at(ms)); ok {
+				got = append(got, string(f.Frame[0]))
+			}
+		}
+		if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("Expected: [a b c]\nGot: %v", got)
+		}
+	})
+
+	t.Run("older than shown", func(t *testing.T) {
+		p := NewPlayout(delay)
+		p.Push(frame("a"), ts(0), at(0))
+		p.Push(frame("c"), ts(80), at(80))
+		p.Pop(at(180))
+		p.Push(frame("b"), ts(40), at(190))
+		if f, ok := p.Pop(at(300)); ok {
+			t.Errorf("expected no frame, got %s", f)
+		}
+		if stats := p.Stats(); stats.Late != 1 || stats.Skipped != 1 {
+			t.Errorf("expected 1 late and 1 skipped frame, got %+v", stats)
+		}
+	})
+
+	t.Run("in step with audio", func(t *testing.T) {
+		p := NewPlayout(delay)
+		p.Push(frame("a"), ts(0), at(0))
+		p.Push(frame("b"), ts(40), at(40))
+
+		// audio heard 30ms after the video would show is within tolerance
+		p.Sync(ts(0), at(130), 40*time.Millisecond)
+		if due, _ := p.Next(); !due.Equal(at(100)) {
+			t.Errorf("Expected: %s\nGot: %s", at(100), due)
+		}
+
+		// but 50ms is not
+		p.Sync(ts(0), at(150), 40*time.Millisecond)
+		if due, _ := p.Next(); !due.Equal(at(150)) {
+			t.Errorf("Expected: %s\nGot: %s", at(150), due)
+		}
+		if _, ok := p.Pop(at(149)); ok {
+			t.Errorf("expected no frame before the audio")
+		}
+		if f, ok := p.Pop(at(150)); !ok || !reflect.DeepEqual(f, frame("a")) {
+			t.Errorf("Expected:\n%s\nGot:\n%s", frame("a"), f)
+		}
+
+		// audio ahead of the video brings it forward
+		p.Sync(ts(0), at(60), 40*time.Millisecond)
+		if due, _ := p.Next(); !due.Equal(at(100)) {
+			t.Errorf("Expected: %s\nGot: %s", at(100), due)
+		}
+	})
+
+	t.Run("fastest transit sets the offset", func(t *testing.T) {
+		p := NewPlayout(delay)
+		p.Push(frame("a"), ts(0), at(50))
+		p.Push(frame("b"), ts(40), at(50))
+		if due, _ := p.Next(); !due.Equal(at(110)) {
+			t.Errorf("Expected: %s\nGot: %s", at(110), due)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package video
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// An .asscam recording is the magic string followed by one record per
+// frame: [ms since the first frame uint32][length uint32][encoded frame],
+// the frame encoded by EncodeFrame in TrueColor mode.
+var recordingMagic = []byte("ASSCAM2")
+
+// oldRecordingMagic starts the recordings of older asscams, which are
+// laid out the same and hold frames DecodeFrame still reads.
+var oldRecordingMagic = []byte("ASSCAM1")
+
+// Recorder writes frames to an .asscam recording.
+type Recorder struct {
+	w     *bufio.Writer
+	file  *os.File
+	start time.Time
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	if _, err := w.Write(recordingMagic); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Recorder{w: w, file: file}, nil
+}
+
+func (r *Recorder) Record(f ColorFrame) error {
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+
+	encoded := EncodeFrame(f, TrueColor)
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[:4], uint32(now.Sub(r.start).Milliseconds()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(encoded)))
+	if _, err := r.w.Write(header); err != nil {
+		return err
+	}
+	_, err := r.w.Write(encoded)
+	return err
+}
+
+func (r *Recorder) Close() error {
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// recordingSource replays an .asscam recording with its original timing,
+// looping at the end.
+type recordingSource struct {
+	file  *os.File
+	r     *bufio.Reader
+	start time.Time
+}
+
+func newRecordingSource(path string) (*recordingSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &recordingSource{file: file}
+	if err := s.rewind(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *recordingSource) rewind() error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.r = bufio.NewReader(s.file)
+	magic := make([]byte, len(recordingMagic))
+	if _, err := io.ReadFull(s.r, magic); err != nil {
+		return errors.New("not an asscam recording")
+	}
+	if string(magic) != string(recordingMagic) && string(magic) != string(oldRecordingMagic) {
+		return errors.New("not an asscam recording")
+	}
+	s.start = time.Now()
+	return nil
+}
+
+func (s *recordingSource) Next() (ColorFrame, error) {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(s.r, header)
+	if err == io.EOF {
+		if err := s.rewind(); err != nil {
+			return ColorFrame{}, err
+		}
+		_, err = io.ReadFull(s.r, header)
+	}
+	if err != nil {
+		return ColorFrame{}, err
+	}
+
+	at := time.Duration(binary.LittleEndian.Uint32(header[:4])) * time.Millisecond
+	encoded := make([]byte, binary.LittleEndian.Uint32(header[4:]))
+	if _, err := io.ReadFull(s.r, encoded); err != nil {
+		return ColorFrame{}, err
+	}
+
+	time.Sleep(time.Until(s.start.Add(at)))
+	return DecodeFrame(encoded)
+}
+
+func (s *recordingSource) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,32 @@
+package video
+
+// ChunkRing remembers the last chunks sent, so the ones a peer asks for
+// again can be resent.
+type ChunkRing struct {
+	chunks []FrameChunk
+	next   int
+}
+
+func NewChunkRing(size int) *ChunkRing {
+	return &ChunkRing{chunks: make([]FrameChunk, 0, size)}
+}
+
+// Add remembers c in place of the oldest chunk once the ring is full.
+func (r *ChunkRing) Add(c FrameChunk) {
+	if len(r.chunks) < cap(r.chunks) {
+		r.chunks = append(r.chunks, c)
+		return
+	}
+	r.chunks[r.next] = c
+	r.next = (r.next + 1) % len(r.chunks)
+}
+
+// Get returns chunk seq of frame id if it is still remembered.
+func (r *ChunkRing) Get(id uint32, seq uint16) (FrameChunk, bool) {
+	for _, c := range r.chunks {
+		if c.FrameId == id && c.SequenceNumber == seq {
+			return c, true
+		}
+	}
+	return FrameChunk{}, false
+}
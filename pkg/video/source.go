@@ -0,0 +1,85 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FrameSource produces the frames a bro sends. Next blocks until the
+// next frame is due and returns io.EOF once the source is exhausted.
+type FrameSource interface {
+	Next() (ColorFrame, error)
+	Close() error
+}
+
+// OpenSource opens the frame source described by spec:
+//
+//	webcam        the default camera
+//	webcam:N      camera number N
+//	pattern       a synthetic moving test pattern
+//	NAME.asscam   a recording made with Recorder
+//	DIR           a directory of PNG, JPEG or GIF images, in name order
+//	FILE          any video file OpenCV can read
+//
+// Frames are width columns wide and drawn with charset, except for
+// recordings which keep the charset they were recorded with. The webcam
+// and video file sources need a build with OpenCV, which is left out
+// with CGO_ENABLED=0 or -tags noopencv.
+func OpenSource(spec string, width int, charset Charset) (FrameSource, error) {
+	switch {
+	case spec == "" || spec == "webcam":
+		return newWebcamSource(0, width, charset)
+	case strings.HasPrefix(spec, "webcam:"):
+		device, err := strconv.Atoi(strings.TrimPrefix(spec, "webcam:"))
+		if err != nil {
+			return nil, fmt.Errorf("bad webcam device %q", spec)
+		}
+		return newWebcamSource(device, width, charset)
+	case spec == "pattern":
+		return newPatternSource(width, charset), nil
+	case strings.HasSuffix(spec, ".asscam"):
+		return newRecordingSource(spec)
+	}
+
+	info, err := os.Stat(spec)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return newImageDirSource(spec, width, charset)
+	}
+	return newVideoFileSource(spec, width, charset)
+}
+
+// CapturedFrame is a frame with the time it was captured at, for it to
+// be played in step with audio captured with it.
+type CapturedFrame struct {
+	ColorFrame
+	At time.Time
+}
+
+// Start pumps frames from source into the returned channel until the
+// source ends or ctx is done, closing the source afterwards. Frames are
+// stamped as they come from the source, before waiting to be taken.
+func Start(ctx context.Context, source FrameSource) chan CapturedFrame {
+	frameC := make(chan CapturedFrame)
+	go func() {
+		defer source.Close()
+		for {
+			frame, err := source.Next()
+			if err != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case frameC <- CapturedFrame{ColorFrame: frame, At: time.Now()}:
+			}
+		}
+	}()
+	return frameC
+}
@@ -0,0 +1,134 @@
+package video
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPatternSource(t *testing.T) {
+	source, err := OpenSource("pattern", 40, ASCII)
+	if err != nil {
+		t.Fatalf("error opening pattern source: %v", err)
+	}
+	defer source.Close()
+
+	first, _ := source.Next()
+	second, _ := source.Next()
+
+	if len(first.Frame) == 0 || len(first.Frame[0]) != 40 {
+		t.Fatalf("expected 40 columns, got %d rows", len(first.Frame))
+	}
+	if len(first.FG) != len(first.Frame) {
+		t.Errorf("expected a color for every row, got %d", len(first.FG))
+	}
+	if reflect.DeepEqual(first, second) {
+		t.Errorf("expected the pattern to move between frames")
+	}
+}
+
+func TestStart(t *testing.T) {
+	source, err := OpenSource("pattern", 40, ASCII)
+	if err != nil {
+		t.Fatalf("error opening pattern source: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := Start(ctx, source)
+	<-frames
+	// the next frame is captured while this waits, and keeps its time
+	time.Sleep(100 * time.Millisecond)
+	f := <-frames
+	if waited := time.Since(f.At); waited < 50*time.Millisecond {
+		t.Errorf("expected the frame stamped when captured, 100ms ago, got %v ago", waited)
+	}
+	if len(f.Frame) == 0 {
+		t.Errorf("expected a frame")
+	}
+}
+
+func TestRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.asscam")
+
+	red, blue := Color{255, 0, 0}, Color{0, 0, 255}
+	frames := []ColorFrame{
+		{
+			Frame: Frame{{'#', '#', '.'}, {'%', '%', '%'}},
+			FG:    [][]Color{{red, red, blue}, {blue, blue, blue}},
+		},
+		{
+			Frame: Frame{{'.', '#', '#'}, {'%', '.', '%'}},
+			FG:    [][]Color{{red, blue, red}, {blue, red, blue}},
+		},
+	}
+
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("error creating recorder: %v", err)
+	}
+	for _, f := range frames {
+		if err := recorder.Record(f); err != nil {
+			t.Fatalf("error recording: %v", err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("error closing recorder: %v", err)
+	}
+
+	source, err := OpenSource(path, 0, ASCII)
+	if err != nil {
+		t.Fatalf("error opening recording: %v", err)
+	}
+	defer source.Close()
+
+	// one more than recorded to check it loops
+	for i := range len(frames) + 1 {
+		f, err := source.Next()
+		if err != nil {
+			t.Fatalf("error reading frame %d: %v", i, err)
+		}
+		if expected := frames[i%len(frames)]; !reflect.DeepEqual(f, expected) {
+			t.Errorf("frame %d\nExpected:\n%v\nGot:\n%v", i, expected, f)
+		}
+	}
+}
+
+func TestOldRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.asscam")
+	frame := Frame{{'#', '#', '.'}}
+	recording := []byte("ASSCAM1")
+	for _, encoded := range [][]byte{frame.RunLengthEncode(), unversionedHalfBlock} {
+		recording = binary.LittleEndian.AppendUint32(recording, 0)
+		recording = binary.LittleEndian.AppendUint32(recording, uint32(len(encoded)))
+		recording = append(recording, encoded...)
+	}
+	if err := os.WriteFile(path, recording, 0o644); err != nil {
+		t.Fatalf("error writing recording: %v", err)
+	}
+
+	source, err := OpenSource(path, 0, ASCII)
+	if err != nil {
+		t.Fatalf("error opening recording: %v", err)
+	}
+	defer source.Close()
+
+	first, err := source.Next()
+	if err != nil {
+		t.Fatalf("error reading frame: %v", err)
+	}
+	if !reflect.DeepEqual(first.Frame, frame) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", frame, first.Frame)
+	}
+	second, err := source.Next()
+	if err != nil {
+		t.Fatalf("error reading frame: %v", err)
+	}
+	if second.Charset != HalfBlock || second.BG == nil {
+		t.Errorf("expected the half block frame, got %v", second)
+	}
+}
@@ -1,5 +1,7 @@
 package video
 
+import "fmt"
+
 func (newFrame Frame) diff(oldFrame Frame) updates {
 
 	if oldFrame == nil {
@@ -21,7 +23,7 @@ func (newFrame Frame) diff(oldFrame Frame) updates {
 		return nil
 	}
 
-	var updates []update
+	updates := []update{}
 	for rowIdx := range newFrame {
 		for colIdx := range newFrame[rowIdx] {
 			oldChar := oldFrame[rowIdx][colIdx]
@@ -37,8 +39,49 @@ func (newFrame Frame) diff(oldFrame Frame) updates {
 	return updates
 }
 
+// diff is Frame.diff for what the frame looks like in mode, so in color
+// modes it also updates the cells whose colors changed.
+func (newFrame ColorFrame) diff(oldFrame ColorFrame, mode ColorMode) updates {
+	updates := newFrame.Frame.diff(oldFrame.Frame)
+	if updates == nil || mode == Mono {
+		return updates
+	}
+	if (newFrame.FG == nil) != (oldFrame.FG == nil) || (newFrame.BG == nil) != (oldFrame.BG == nil) {
+		return nil
+	}
+	if newFrame.FG == nil {
+		return updates
+	}
+
+	updates = updates[:0]
+	for rowIdx := range newFrame.Frame {
+		for colIdx := range newFrame.Frame[rowIdx] {
+			seq, char := newFrame.cell(rowIdx, colIdx, mode)
+			oldSeq, oldChar := oldFrame.cell(rowIdx, colIdx, mode)
+			if seq != oldSeq || char != oldChar {
+				updates = append(
+					updates,
+					update{rowIdx: rowIdx, colIdx: colIdx, char: char, seq: seq},
+				)
+			}
+		}
+	}
+	return updates
+}
+
 func (ups updates) do() {
+	ups.doAt(0, 0)
+}
+
+// doAt applies the updates to a frame whose top-left cell sits at the
+// 0-based terminal position (row, col).
+func (ups updates) doAt(row, col int) {
 	for _, update := range ups {
-		moveAndWrite(update.rowIdx, update.colIdx, update.char)
+		if update.seq == "" {
+			moveAndWrite(row+update.rowIdx+1, col+update.colIdx+1, update.char)
+			continue
+		}
+		moveCursor(row+update.rowIdx+1, col+update.colIdx+1)
+		fmt.Print(update.seq + string(update.char) + sgrReset)
 	}
 }
@@ -1,14 +1,18 @@
+//go:build cgo && !noopencv
+
 package video
 
 import (
 	"errors"
+	"io"
+	"time"
 
 	"gocv.io/x/gocv"
 )
 
-func startWebcam() (*gocv.VideoCapture, error) {
+func startWebcam(device int) (*gocv.VideoCapture, error) {
 
-	webcam, err := gocv.VideoCaptureDevice(0)
+	webcam, err := gocv.VideoCaptureDevice(device)
 	if err != nil {
 		return nil, err
 	}
@@ -19,3 +23,101 @@ func startWebcam() (*gocv.VideoCapture, error) {
 
 	return webcam, nil
 }
+
+// captureSource reads frames through OpenCV, from a camera or a file.
+type captureSource struct {
+	capture *gocv.VideoCapture
+	width   int
+	charset Charset
+	// reopen restarts a file from the beginning, nil for cameras
+	reopen func() (*gocv.VideoCapture, error)
+	// interval paces files at their own frame rate, zero for cameras
+	interval time.Duration
+	next     time.Time
+}
+
+func newWebcamSource(device int, width int, charset Charset) (FrameSource, error) {
+	webcam, err := startWebcam(device)
+	if err != nil {
+		return nil, err
+	}
+	return &captureSource{capture: webcam, width: width, charset: charset}, nil
+}
+
+// newVideoFileSource plays the file at its own frame rate, looping at
+// the end.
+func newVideoFileSource(path string, width int, charset Charset) (FrameSource, error) {
+	open := func() (*gocv.VideoCapture, error) {
+		capture, err := gocv.VideoCaptureFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !capture.IsOpened() {
+			return nil, errors.New("Video file could not be opened")
+		}
+		return capture, nil
+	}
+
+	capture, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	fps := capture.Get(gocv.VideoCaptureFPS)
+	if fps <= 0 {
+		fps = 30
+	}
+
+	return &captureSource{
+		capture:  capture,
+		width:    width,
+		charset:  charset,
+		reopen:   open,
+		interval: time.Duration(float64(time.Second) / fps),
+	}, nil
+}
+
+func (s *captureSource) Next() (ColorFrame, error) {
+	if s.interval > 0 {
+		time.Sleep(time.Until(s.next))
+		s.next = time.Now().Add(s.interval)
+	}
+
+	rewound := false
+	for {
+		screenMaterial := gocv.NewMat()
+		if ok := s.capture.Read(&screenMaterial); !ok {
+			screenMaterial.Close()
+			if s.reopen == nil || rewound {
+				return ColorFrame{}, io.EOF
+			}
+			rewound = true
+			s.capture.Close()
+			capture, err := s.reopen()
+			if err != nil {
+				return ColorFrame{}, err
+			}
+			s.capture = capture
+			continue
+		}
+		if screenMaterial.Empty() {
+			screenMaterial.Close()
+			continue
+		}
+		return matToAscii(screenMaterial, s.width, s.charset)
+	}
+}
+
+func (s *captureSource) Close() error {
+	return s.capture.Close()
+}
+
+// matToAscii converts a captured BGR frame with charset, closing it.
+func matToAscii(frame gocv.Mat, width int, charset Charset) (ColorFrame, error) {
+	defer frame.Close()
+	img, err := frame.ToImage()
+	if err != nil {
+		return ColorFrame{}, err
+	}
+	return charset.Convert(img, width), nil
+}
@@ -0,0 +1,15 @@
+//go:build !cgo || noopencv
+
+package video
+
+import "errors"
+
+var errNoOpenCV = errors.New("built without OpenCV; webcam and video file sources are unavailable")
+
+func newWebcamSource(device int, width int, charset Charset) (FrameSource, error) {
+	return nil, errNoOpenCV
+}
+
+func newVideoFileSource(path string, width int, charset Charset) (FrameSource, error) {
+	return nil, errNoOpenCV
+}